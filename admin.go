@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandlers serves the admin endpoints for inspecting the notification outbox
+type AdminHandlers struct {
+	outbox *Outbox
+}
+
+// NewAdminHandlers creates the admin handlers for outbox
+func NewAdminHandlers(outbox *Outbox) *AdminHandlers {
+	return &AdminHandlers{outbox: outbox}
+}
+
+// AdminAuth requires "Authorization: Bearer <token>"
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListOutbox lists outbox entries, optionally filtered with ?status=
+// (pending, delivered, failed) and ?notifier=
+func (a *AdminHandlers) ListOutbox(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", outboxPending, outboxDelivered, outboxFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, delivered or failed"})
+		return
+	}
+
+	entries := a.outbox.List(status)
+	if notifier := c.Query("notifier"); notifier != "" {
+		filtered := entries[:0]
+		for _, entry := range entries {
+			if entry.Notifier == notifier {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"counts":  a.outbox.Counts(),
+		"entries": entries,
+	})
+}
+
+// GetOutboxEntry returns one outbox entry
+func (a *AdminHandlers) GetOutboxEntry(c *gin.Context) {
+	entry, ok := a.outbox.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "outbox entry not found"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// RetryOutboxEntry makes a pending or failed entry due for delivery now
+func (a *AdminHandlers) RetryOutboxEntry(c *gin.Context) {
+	id := c.Param("id")
+	if err := a.outbox.Retry(id); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, errOutboxNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"id": id, "status": outboxPending})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// CloudEvents HTTP content modes
+const (
+	cloudEventsStructured = "structured"
+	cloudEventsBinary     = "binary"
+)
+
+const defaultCloudEventType = "com.example.error.tracked"
+
+// CloudEventsNotifier emits every tracked error as a CloudEvents 1.0 event
+// over HTTP, in structured or binary content mode
+type CloudEventsNotifier struct {
+	sender    *httpSender
+	mode      string
+	eventType string
+	source    string
+}
+
+// CloudEvent is a CloudEvents 1.0 event in its JSON (structured) form.
+// severity and environment are extension attributes.
+type CloudEvent struct {
+	SpecVersion     string         `json:"specversion"`
+	ID              string         `json:"id"`
+	Source          string         `json:"source"`
+	Type            string         `json:"type"`
+	Subject         string         `json:"subject,omitempty"`
+	Time            string         `json:"time"`
+	DataContentType string         `json:"datacontenttype"`
+	Severity        string         `json:"severity,omitempty"`
+	Environment     string         `json:"environment,omitempty"`
+	Data            CloudEventData `json:"data"`
+}
+
+// CloudEventData is the event payload
+type CloudEventData struct {
+	Context     string                 `json:"context"`
+	Error       string                 `json:"error"`
+	Fingerprint string                 `json:"fingerprint"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	StackTrace  string                 `json:"stack_trace,omitempty"`
+	Host        string                 `json:"host"`
+	Version     string                 `json:"version,omitempty"`
+}
+
+// NewCloudEventsNotifier configures CloudEvents delivery from
+// CLOUDEVENTS_URL, CLOUDEVENTS_MODE (structured or binary), CLOUDEVENTS_TYPE
+// and CLOUDEVENTS_SOURCE. It returns nil when CLOUDEVENTS_URL is not set.
+func NewCloudEventsNotifier() *CloudEventsNotifier {
+	url := os.Getenv("CLOUDEVENTS_URL")
+	if url == "" {
+		return nil
+	}
+
+	mode := strings.ToLower(os.Getenv("CLOUDEVENTS_MODE"))
+	if mode != cloudEventsBinary {
+		if mode != "" && mode != cloudEventsStructured {
+			fmt.Fprintf(os.Stderr, "Unknown CLOUDEVENTS_MODE=%q, using structured\n", mode)
+		}
+		mode = cloudEventsStructured
+	}
+
+	eventType := os.Getenv("CLOUDEVENTS_TYPE")
+	if eventType == "" {
+		eventType = defaultCloudEventType
+	}
+	source := os.Getenv("CLOUDEVENTS_SOURCE")
+	if source == "" {
+		source = getServiceName()
+	}
+
+	return &CloudEventsNotifier{
+		sender:    newHTTPSender("CloudEvents", url, 0),
+		mode:      mode,
+		eventType: eventType,
+		source:    source,
+	}
+}
+
+// Name implements Notifier
+func (c *CloudEventsNotifier) Name() string {
+	return "cloudevents"
+}
+
+// Notify emits the event for err
+func (c *CloudEventsNotifier) Notify(err *errorid.ErrorWithID) error {
+	event := c.buildEvent(err)
+	body, header, encodeErr := encodeCloudEvent(event, c.mode)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	return c.sender.PostWithHeaders(err.ID, body, header)
+}
+
+// buildEvent converts err into a CloudEvent; id is the error ID
+func (c *CloudEventsNotifier) buildEvent(err *errorid.ErrorWithID) CloudEvent {
+	meta := getRuntimeMetadata()
+	details, _ := sanitizeDetails(err.Details)
+
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              err.ID,
+		Source:          c.source,
+		Type:            c.eventType,
+		Subject:         err.Context,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		Severity:        errorSeverity(err).String(),
+		Environment:     getEnvironment(),
+		Data: CloudEventData{
+			Context:     err.Context,
+			Error:       errorMessage(err.Original),
+			Fingerprint: errorFingerprint(err),
+			Details:     details,
+			StackTrace:  err.StackTrace,
+			Host:        meta.Location(),
+			Version:     meta.Version,
+		},
+	}
+}
+
+// encodeCloudEvent returns the HTTP body and headers for event. Structured
+// mode sends the whole event as application/cloudevents+json; binary mode
+// sends the data as the body and the attributes as ce-* headers.
+func encodeCloudEvent(event CloudEvent, mode string) ([]byte, http.Header, error) {
+	header := http.Header{}
+
+	if mode == cloudEventsStructured {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal CloudEvent: %w", err)
+		}
+		header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+		return body, header, nil
+	}
+
+	body, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal CloudEvent data: %w", err)
+	}
+	header.Set("Content-Type", event.DataContentType)
+	header.Set("ce-specversion", event.SpecVersion)
+	header.Set("ce-id", event.ID)
+	header.Set("ce-source", event.Source)
+	header.Set("ce-type", event.Type)
+	header.Set("ce-time", event.Time)
+	if event.Subject != "" {
+		header.Set("ce-subject", cloudEventHeaderValue(event.Subject))
+	}
+	if event.Severity != "" {
+		header.Set("ce-severity", event.Severity)
+	}
+	if event.Environment != "" {
+		header.Set("ce-environment", event.Environment)
+	}
+	return body, header, nil
+}
+
+// cloudEventHeaderValue percent-encodes characters that are not allowed
+// in ce-* header values (non-printable ASCII, '"' and '%'), as the HTTP
+// binding requires
+func cloudEventHeaderValue(value string) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		if c < 0x20 || c > 0x7e || c == '"' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Digest schedules
+const (
+	digestHourly = "hourly"
+	digestDaily  = "daily"
+)
+
+const digestTopGroups = 5
+
+// DigestScheduler periodically posts an error digest embed to Discord
+type DigestScheduler struct {
+	stats      *ErrorStats
+	webhookURL string
+	httpClient *http.Client
+	schedule   string
+	dailyAt    int // minutes after midnight
+	location   *time.Location
+	stopChan   chan struct{}
+}
+
+// NewDigestScheduler configures a digest from DIGEST_SCHEDULE (hourly or
+// daily), DIGEST_TIME ("HH:MM" for daily digests) and DIGEST_TIMEZONE.
+// Digests go to DIGEST_WEBHOOK_URL, falling back to DISCORD_WEBHOOK_URL.
+// It returns nil when digests are disabled.
+func NewDigestScheduler(stats *ErrorStats) *DigestScheduler {
+	schedule := strings.ToLower(os.Getenv("DIGEST_SCHEDULE"))
+	if schedule != digestHourly && schedule != digestDaily {
+		if schedule != "" && schedule != "off" {
+			fmt.Fprintf(os.Stderr, "Unknown DIGEST_SCHEDULE=%q, digests disabled\n", schedule)
+		}
+		return nil
+	}
+
+	webhookURL := os.Getenv("DIGEST_WEBHOOK_URL")
+	if webhookURL == "" {
+		webhookURL = os.Getenv("DISCORD_WEBHOOK_URL")
+	}
+	if webhookURL == "" {
+		fmt.Fprintln(os.Stderr, "No webhook configured for error digests, digests disabled")
+		return nil
+	}
+
+	location := time.Local
+	if tz := os.Getenv("DIGEST_TIMEZONE"); tz != "" {
+		loaded, err := time.LoadLocation(tz)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid DIGEST_TIMEZONE=%q: %v, using local time\n", tz, err)
+		} else {
+			location = loaded
+		}
+	}
+
+	dailyAt := 9 * 60
+	if raw := os.Getenv("DIGEST_TIME"); raw != "" {
+		if minutes, err := parseClock(raw); err == nil {
+			dailyAt = minutes
+		} else {
+			fmt.Fprintf(os.Stderr, "Invalid DIGEST_TIME=%q, using 09:00\n", raw)
+		}
+	}
+
+	return &DigestScheduler{
+		stats:      stats,
+		webhookURL: webhookURL,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		schedule: schedule,
+		dailyAt:  dailyAt,
+		location: location,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start runs the scheduler until Stop is called
+func (s *DigestScheduler) Start() {
+	for {
+		now := time.Now().In(s.location)
+		next := s.nextRun(now)
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C:
+			s.post(next)
+		case <-s.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Stop stops the scheduler
+func (s *DigestScheduler) Stop() {
+	close(s.stopChan)
+}
+
+// nextRun returns the next digest time after now
+func (s *DigestScheduler) nextRun(now time.Time) time.Time {
+	if s.schedule == digestHourly {
+		// Built from the wall clock: Truncate rounds in absolute time, which
+		// is off the hour in zones with a non-whole-hour UTC offset
+		hour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, s.location)
+		return hour.Add(time.Hour)
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), s.dailyAt/60, s.dailyAt%60, 0, 0, s.location)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// period returns the digest window ending at end
+func (s *DigestScheduler) period(end time.Time) time.Time {
+	if s.schedule == digestHourly {
+		return end.Add(-time.Hour)
+	}
+	return end.AddDate(0, 0, -1)
+}
+
+// post sends the digest for the period ending at end
+func (s *DigestScheduler) post(end time.Time) {
+	start := s.period(end)
+	stats := s.stats.Summarize(start, end)
+	message := DiscordMessage{Embeds: []Embed{s.buildEmbed(stats)}}
+
+	getDiscordQueue(s.webhookURL, s.httpClient).Enqueue(discordDelivery{
+		label: fmt.Sprintf("%s error digest", s.schedule),
+		build: func() (*http.Request, error) {
+			return newDiscordRequest(http.MethodPost, s.webhookURL, message)
+		},
+	})
+}
+
+// buildEmbed renders period statistics as a Discord embed
+func (s *DigestScheduler) buildEmbed(stats periodStats) Embed {
+	name, unit := "Daily", "day"
+	if s.schedule == digestHourly {
+		name, unit = "Hourly", "hour"
+	}
+
+	title := fmt.Sprintf("%s error digest: %s – %s",
+		name,
+		stats.Start.In(s.location).Format("Jan 2 15:04"),
+		stats.End.In(s.location).Format("Jan 2 15:04 MST"))
+
+	description := fmt.Sprintf("**%d** errors in %d groups (%d new)\n%s vs previous %s (%d)",
+		stats.Total, len(stats.Groups), len(stats.NewGroups), formatTrend(stats.Total, stats.PreviousTotal), unit, stats.PreviousTotal)
+
+	color := 3066993 // Green
+	if stats.Total > 0 {
+		color = SeverityWarning.DiscordColor()
+	}
+	if len(stats.NewGroups) > 0 || stats.Total > stats.PreviousTotal*2 && stats.Total > 10 {
+		color = SeverityError.DiscordColor()
+	}
+
+	hours := stats.End.Sub(stats.Start).Hours()
+	embed := NewEmbedBuilder().
+		Title(title).
+		Description(description).
+		Color(color).
+		Field("Error Rate", fmt.Sprintf("%.1f/h (previous %.1f/h)", float64(stats.Total)/hours, float64(stats.PreviousTotal)/hours), true).
+		Footer(getRuntimeMetadata().BuildLabel()).
+		Timestamp(stats.End)
+
+	if len(stats.Groups) > 0 {
+		embed.Field("Top Error Groups", formatGroups(stats.Groups, digestTopGroups), false)
+	}
+	if len(stats.NewGroups) > 0 {
+		embed.Field("New Error Groups", formatGroups(stats.NewGroups, digestTopGroups), false)
+	}
+	if len(stats.ByHandler) > 0 {
+		embed.Field("By Handler", formatCounts(stats.ByHandler), true)
+	}
+
+	return embed.Build()
+}
+
+// formatTrend renders the change between two totals ("▲ 25%", "▼ 10%", "= 0%")
+func formatTrend(current, previous int) string {
+	switch {
+	case previous == 0 && current == 0:
+		return "= no change"
+	case previous == 0:
+		return "▲ new"
+	}
+	change := float64(current-previous) / float64(previous) * 100
+	switch {
+	case change > 0:
+		return fmt.Sprintf("▲ %.0f%%", change)
+	case change < 0:
+		return fmt.Sprintf("▼ %.0f%%", -change)
+	default:
+		return "= 0%"
+	}
+}
+
+// formatGroups lists up to limit groups as "`12×` context: message"
+func formatGroups(groups []errorGroupCount, limit int) string {
+	var lines []string
+	for i, group := range groups {
+		if i == limit {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(groups)-limit))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("`%d×` **%s**: %s", group.Count, escapeMarkdown(group.Context), escapeMarkdown(truncateString(group.Message, 80))))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatCounts lists counts as "`12` key", highest first
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("`%d` %s", counts[key], escapeMarkdown(key)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	errorid "github.com/isaui/go-support-id-error"
@@ -15,31 +17,100 @@ import (
 type DiscordWebhook struct {
 	webhookURL string
 	httpClient *http.Client
+	router     *discordRouter
+	aggregator *notificationAggregator
+	threads    *discordThreadStore
+	live       *liveMessageTracker
+	mentions   *discordMentions
+	sampler    *severitySampler
 }
 
-// NewDiscordWebhook creates a new Discord webhook handler
+// NewDiscordWebhook creates a new Discord webhook handler.
+// webhookURL is the default route; DISCORD_ROUTES_FILE adds routing rules.
 func NewDiscordWebhook(webhookURL string) *DiscordWebhook {
-	return &DiscordWebhook{
+	d := &DiscordWebhook{
 		webhookURL: webhookURL,
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
 	}
+
+	router, err := loadDiscordRouter(webhookURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v, using DISCORD_WEBHOOK_URL only\n", err)
+		router = &discordRouter{config: DiscordRoutingConfig{Default: expandEnvList([]string{webhookURL})}}
+	}
+	d.router = router
+
+	threadsFile := os.Getenv("DISCORD_THREADS_FILE")
+	if threadsFile == "" {
+		threadsFile = "discord_threads.json"
+	}
+	d.threads = loadDiscordThreadStore(threadsFile)
+	d.live = newLiveMessageTracker()
+
+	mentions, err := loadDiscordMentions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v, on-call mentions disabled\n", err)
+		mentions = &discordMentions{location: time.UTC, now: time.Now}
+	}
+	d.mentions = mentions
+	d.sampler = loadSeveritySampler("DISCORD_SAMPLE_RATES")
+
+	d.aggregator = newNotificationAggregator(aggregationWindowFor(getEnvironment()), d.sendAggregationSummary)
+	return d
+}
+
+// Name implements Notifier
+func (d *DiscordWebhook) Name() string {
+	return "discord"
+}
+
+// Notify implements Notifier. It returns once every webhook queue has
+// delivered or given up on the message, so the outbox only marks it
+// delivered after Discord accepted it.
+func (d *DiscordWebhook) Notify(err *errorid.ErrorWithID) error {
+	return d.SendErrorNotification(err)
+}
+
+// NotifyDelivery implements deliveryNotifier. Outbox replays bypass
+// sampling, aggregation and live updates and are posted to the webhooks
+// that failed before, so a replay is only marked delivered once posted.
+func (d *DiscordWebhook) NotifyDelivery(err *errorid.ErrorWithID, delivery Delivery, done func(error)) {
+	done(d.sendErrorNotification(err, delivery))
+}
+
+// Close flushes pending aggregation summaries and drains the delivery queues
+func (d *DiscordWebhook) Close(timeout time.Duration) {
+	d.aggregator.Flush()
+	closeDiscordQueues(timeout)
 }
 
 // DiscordMessage represents a Discord webhook message
 type DiscordMessage struct {
 	Content string   `json:"content,omitempty"`
 	Embeds  []Embed  `json:"embeds,omitempty"`
+	// ThreadName creates a new forum post (forum channel webhooks only)
+	ThreadName      string              `json:"thread_name,omitempty"`
+	AllowedMentions *AllowedMentions    `json:"allowed_mentions,omitempty"`
+	Attachments     []discordAttachment `json:"attachments,omitempty"`
+	// Files are uploaded as multipart parts and listed in Attachments
+	Files []discordFile `json:"-"`
 }
 
 // Embed represents a Discord embed
 type Embed struct {
-	Title       string  `json:"title"`
-	Description string  `json:"description"`
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
 	Color       int     `json:"color"`
 	Fields      []Field `json:"fields,omitempty"`
-	Timestamp   string  `json:"timestamp"`
+	Footer      *Footer `json:"footer,omitempty"`
+	Timestamp   string  `json:"timestamp,omitempty"`
+}
+
+// Footer represents a Discord embed footer
+type Footer struct {
+	Text string `json:"text"`
 }
 
 // Field represents a Discord embed field
@@ -49,115 +120,273 @@ type Field struct {
 	Inline bool   `json:"inline"`
 }
 
-// SendErrorNotification sends error notification to Discord
-func (d *DiscordWebhook) SendErrorNotification(err *errorid.ErrorWithID) {
-	if d.webhookURL == "" {
-		fmt.Println("Discord webhook URL not configured, skipping notification")
-		return
+// SendErrorNotification sends error notification to Discord and waits for
+// the outcome. Occurrences folded into an aggregation summary or a pending
+// live update count as delivered.
+func (d *DiscordWebhook) SendErrorNotification(err *errorid.ErrorWithID) error {
+	return d.sendErrorNotification(err, Delivery{})
+}
+
+// sendErrorNotification sends err to the webhooks delivery includes. Failed
+// webhooks are reported as targetErrors keyed by webhook ID.
+func (d *DiscordWebhook) sendErrorNotification(err *errorid.ErrorWithID, delivery Delivery) error {
+	// Low-severity noise can be sampled; the error is still logged to ELK
+	if !delivery.Replay && !d.sampler.Keep(errorSeverity(err)) {
+		return nil
 	}
 
-	// Build Discord embed with proper limits
-	description := fmt.Sprintf("**Error:** %v\n**Context:** %s", err.Original, err.Context)
-	if len(description) > 2048 {
-		description = description[:2048]
+	targets := d.router.Resolve(err)
+	if len(targets) == 0 {
+		return fmt.Errorf("no Discord webhook configured for %s", err.ID)
 	}
 
-	embed := Embed{
-		Title:       truncateString(fmt.Sprintf("Error: %s", err.ID), 256),
-		Description: description,
-		Color:       15158332, // Red color
-		Fields:      []Field{},
+	message := buildErrorMessage(err)
+	d.mentions.Apply(err, &message)
+	fingerprint := errorFingerprint(err)
+	threadName := fmt.Sprintf("%s: %v", err.Context, err.Original)
+
+	type pending struct {
+		key    string
+		result <-chan error
 	}
+	var results []pending
+	for _, target := range targets {
+		key := discordWebhookID(target.URL)
+		if !delivery.includes(key) {
+			continue
+		}
 
-	// Add details (metadata) if available
-	if err.Details != nil && len(err.Details) > 0 {
-		detailsValue := formatDetails(err.Details)
-		if detailsValue != "" && detailsValue != "None" {
-			embed.Fields = append(embed.Fields, Field{
-				Name:   "Details",
-				Value:  truncateString(detailsValue, 1024),
-				Inline: false,
-			})
+		if delivery.Replay {
+			results = append(results, pending{key, d.sendToDiscord(target, fingerprint, threadName, message, nil)})
+			continue
+		}
+
+		// Live updates edit one message per group instead of aggregating
+		if d.live != nil {
+			if result := d.sendLiveUpdate(target, fingerprint, threadName, err, message); result != nil {
+				results = append(results, pending{key, result})
+			}
+			continue
+		}
+
+		// Repeated errors within the aggregation window are only counted
+		if !d.aggregator.Observe(target, fingerprint, err.ID, err.Context, errorMessage(err.Original)) {
+			continue
 		}
+		results = append(results, pending{key, d.sendToDiscord(target, fingerprint, threadName, message, nil)})
+	}
+
+	failed := targetErrors{}
+	for _, p := range results {
+		if sendErr := <-p.result; sendErr != nil {
+			failed[p.key] = sendErr
+		}
+	}
+	return failed.err()
+}
+
+// buildErrorMessage renders an error as a Discord embed message.
+// Error text is markdown-escaped; EmbedBuilder enforces Discord's limits.
+func buildErrorMessage(err *errorid.ErrorWithID) DiscordMessage {
+	severity := errorSeverity(err)
+	meta := getRuntimeMetadata()
+
+	embed := NewEmbedBuilder().
+		Title(fmt.Sprintf("Error: %s", err.ID)).
+		Description(fmt.Sprintf("**Error:** %s\n**Context:** %s", escapeMarkdown(errorMessage(err.Original)), escapeMarkdown(err.Context))).
+		Color(severity.DiscordColor()).
+		Field("Severity", strings.ToUpper(severity.String()), true)
+
+	// Add the request ID so the error can be found in the access log
+	if requestID, ok := err.Details["request_id"].(string); ok && requestID != "" {
+		embed.Field("Request ID", "`"+requestID+"`", true)
+	}
+
+	// Add details (metadata) if available
+	if len(err.Details) > 0 {
+		embed.Field("Details", formatDetails(err.Details), false)
 	}
 
 	// Add environment info
 	if env := os.Getenv("ENVIRONMENT"); env != "" {
-		embed.Fields = append(embed.Fields, Field{
-			Name:   "Environment",
-			Value:  env,
-			Inline: true,
-		})
+		embed.Field("Environment", escapeMarkdown(env), true)
+	}
+
+	// Add host/container info and build metadata
+	embed.Field("Host", escapeMarkdown(meta.Location()), true)
+	embed.Footer(meta.BuildLabel())
+
+	// Full stack trace, details and request snapshot go out as files
+	var files []discordFile
+	if discordAttachmentsEnabled() {
+		files = buildErrorAttachments(err)
 	}
 
 	// Add stack trace if available (separate from details in v1.1.0+)
 	if err.StackTrace != "" {
-		stackTrace := err.StackTrace
-		if len(stackTrace) > 900 {
-			stackTrace = stackTrace[:900] + "..."
+		name := "Stack Trace"
+		if len(files) > 0 {
+			name = "Stack Trace (preview)"
 		}
-		embed.Fields = append(embed.Fields, Field{
-			Name:   "Stack Trace",
-			Value:  "```\n" + stackTrace + "\n```",
-			Inline: false,
-		})
+		embed.CodeField(name, err.StackTrace)
 	}
 
-	message := DiscordMessage{
-		Embeds: []Embed{embed},
+	if len(files) > 0 {
+		embed.Field("Attachments", "Full data attached: "+attachmentSummary(files), false)
 	}
 
-	// Send to Discord
-	go d.sendToDiscord(message)
+	return DiscordMessage{
+		Embeds: []Embed{embed.Build()},
+		Files:  files,
+	}
 }
 
-// sendToDiscord sends message to Discord webhook
-func (d *DiscordWebhook) sendToDiscord(message DiscordMessage) {
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to marshal Discord message: %v\n", err)
-		return
+// sendAggregationSummary posts a follow-up for occurrences suppressed in a window
+func (d *DiscordWebhook) sendAggregationSummary(summary aggregationSummary) {
+	times := "times"
+	if summary.Count == 1 {
+		times = "time"
 	}
 
-	req, err := http.NewRequest("POST", d.webhookURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create Discord request: %v\n", err)
-		return
+	embed := NewEmbedBuilder().
+		Title(fmt.Sprintf("Repeated: %s", summary.Context)).
+		Description(fmt.Sprintf("Seen **%d** more %s in %s, last **%s**\n**Error:** %s\n**First:** %s",
+			summary.Count, times, formatWindow(summary.Window), summary.LastID, escapeMarkdown(summary.Message), summary.FirstID)).
+		Color(15105570). // Orange color
+		Field("Fingerprint", summary.Fingerprint, true).
+		Timestamp(summary.LastSeen).
+		Build()
+
+	threadName := fmt.Sprintf("%s: %s", summary.Context, summary.Message)
+	d.sendToDiscord(summary.Target, summary.Fingerprint, threadName, DiscordMessage{Embeds: []Embed{embed}}, nil)
+}
+
+// sendToDiscord queues message for ordered, rate-limit aware delivery to a target.
+// Forum targets get one thread per fingerprint: the first message creates it
+// with thread_name, later ones post into it with thread_id. When onPosted is
+// set the message is posted with ?wait=true and receives the created message
+// and channel IDs. The returned channel receives the delivery outcome.
+func (d *DiscordWebhook) sendToDiscord(target discordTarget, fingerprint, threadName string, message DiscordMessage, onPosted func(messageID, channelID string)) <-chan error {
+	result := make(chan error, 1)
+	delivery := d.postDelivery(target, fingerprint, threadName, message, onPosted)
+	delivery.onDone = func(err error) { result <- err }
+	getDiscordQueue(target.URL, d.httpClient).Enqueue(delivery)
+	return result
+}
+
+// postDelivery builds the delivery that posts message to target, see
+// sendToDiscord
+func (d *DiscordWebhook) postDelivery(target discordTarget, fingerprint, threadName string, message DiscordMessage, onPosted func(messageID, channelID string)) discordDelivery {
+	label := message.Content
+	if len(message.Embeds) > 0 {
+		label = message.Embeds[0].Title
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	postURL := target.URL
+	if onPosted != nil {
+		postURL = withQuery(postURL, "wait", "true")
+	}
+
+	delivery := discordDelivery{
+		label: label,
+		build: func() (*http.Request, error) {
+			return newDiscordRequest(http.MethodPost, postURL, message)
+		},
+	}
+	if onPosted != nil {
+		delivery.onSuccess = func(body []byte) {
+			var posted discordPostedMessage
+			if err := json.Unmarshal(body, &posted); err == nil && posted.ID != "" {
+				onPosted(posted.ID, posted.ChannelID)
+			}
+		}
+	}
+
+	if target.Forum {
+		key := threadKey(target.URL, fingerprint)
+		delivery.build = func() (*http.Request, error) {
+			// Resolved at send time: the queue is ordered, so a thread created
+			// by an earlier delivery is already known here
+			if threadID := d.threads.Get(key); threadID != "" {
+				return newDiscordRequest(http.MethodPost, withQuery(postURL, "thread_id", threadID), message)
+			}
+			forumPost := message
+			forumPost.ThreadName = threadName
+			return newDiscordRequest(http.MethodPost, withQuery(target.URL, "wait", "true"), forumPost)
+		}
+		delivery.onSuccess = func(body []byte) {
+			var posted discordPostedMessage
+			if err := json.Unmarshal(body, &posted); err != nil || posted.ChannelID == "" {
+				return
+			}
+			if d.threads.Get(key) == "" {
+				d.threads.Set(key, posted.ChannelID)
+			}
+			if onPosted != nil && posted.ID != "" {
+				onPosted(posted.ID, posted.ChannelID)
+			}
+		}
+		delivery.onFailure = func(status int, body []byte) bool {
+			// Thread was deleted in Discord: forget it and open a new one
+			if d.threads.Get(key) != "" && isUnknownThread(status, body) {
+				d.threads.Delete(key)
+				return true
+			}
+			return false
+		}
+	}
+	return delivery
+}
+
+// discordPostedMessage is the part of a ?wait=true response we keep
+type discordPostedMessage struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+}
+
+// newDiscordRequest builds a request for a Discord webhook endpoint: JSON,
+// or multipart/form-data when the message carries files
+func newDiscordRequest(method, url string, message DiscordMessage) (*http.Request, error) {
+	message = limitDiscordMessage(message)
 
-	resp, err := d.httpClient.Do(req)
+	// Error text must never be able to ping @everyone or arbitrary roles
+	if message.AllowedMentions == nil {
+		message.AllowedMentions = &AllowedMentions{Parse: []string{}}
+	}
+
+	if len(message.Files) > 0 {
+		return newDiscordMultipartRequest(method, url, message)
+	}
+
+	jsonData, err := json.Marshal(message)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to send to Discord: %v\n", err)
-		return
+		return nil, fmt.Errorf("failed to marshal Discord message: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		fmt.Fprintf(os.Stderr, "Discord webhook returned error status: %d\n", resp.StatusCode)
-	} else {
-		fmt.Printf("Error notification sent to Discord: %s\n", message.Embeds[0].Title)
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
 	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
 }
 
-// formatDetails converts Details map to readable string for Discord
+// formatDetails converts Details map to readable string for Discord,
+// sorted by key and with markdown escaped
 func formatDetails(details map[string]interface{}) string {
 	if len(details) == 0 {
 		return "None"
 	}
 
-	var result string
-	for key, value := range details {
-		result += fmt.Sprintf("• **%s**: %v\n", key, value)
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
 	}
-	return result
-}
+	sort.Strings(keys)
 
-// truncateString truncates string to max length
-func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
+	var result strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&result, "• **%s**: %s\n", escapeMarkdown(key), escapeMarkdown(fmt.Sprint(details[key])))
 	}
-	return s[:maxLen-3] + "..."
+	return result.String()
 }
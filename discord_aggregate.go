@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAggregationWindow is used when no window is configured for the environment
+const defaultAggregationWindow = 5 * time.Minute
+
+// aggregationSummary describes occurrences suppressed during one window
+type aggregationSummary struct {
+	Target      discordTarget
+	Fingerprint string
+	Context     string
+	Message     string
+	FirstID     string
+	LastID      string
+	Count       int
+	Window      time.Duration
+	LastSeen    time.Time
+}
+
+// aggregationGroup tracks one fingerprint inside its current window
+type aggregationGroup struct {
+	summary aggregationSummary
+	timer   *time.Timer
+}
+
+// notificationAggregator lets the first occurrence of a fingerprint through
+// and counts the rest until the window closes, then reports them via flush
+type notificationAggregator struct {
+	mu     sync.Mutex
+	window time.Duration
+	groups map[string]*aggregationGroup
+	flush  func(aggregationSummary)
+}
+
+// newNotificationAggregator creates an aggregator; a zero window disables aggregation
+func newNotificationAggregator(window time.Duration, flush func(aggregationSummary)) *notificationAggregator {
+	return &notificationAggregator{
+		window: window,
+		groups: make(map[string]*aggregationGroup),
+		flush:  flush,
+	}
+}
+
+// Observe records an occurrence for a target and reports whether it should be posted now
+func (a *notificationAggregator) Observe(target discordTarget, fingerprint, errorID, context, message string) bool {
+	if a.window <= 0 {
+		return true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := target.URL + "|" + fingerprint
+	if group, ok := a.groups[key]; ok {
+		group.summary.Count++
+		group.summary.LastID = errorID
+		group.summary.LastSeen = time.Now()
+		return false
+	}
+
+	a.groups[key] = &aggregationGroup{
+		summary: aggregationSummary{
+			Target:      target,
+			Fingerprint: fingerprint,
+			Context:     context,
+			Message:     message,
+			FirstID:     errorID,
+			Window:      a.window,
+		},
+		timer: time.AfterFunc(a.window, func() { a.closeWindow(key) }),
+	}
+	return true
+}
+
+// closeWindow ends a group's window and flushes suppressed occurrences
+func (a *notificationAggregator) closeWindow(key string) {
+	a.mu.Lock()
+	group, ok := a.groups[key]
+	delete(a.groups, key)
+	a.mu.Unlock()
+
+	if ok && group.summary.Count > 0 {
+		a.flush(group.summary)
+	}
+}
+
+// Flush closes every open window immediately, e.g. on shutdown
+func (a *notificationAggregator) Flush() {
+	a.mu.Lock()
+	keys := make([]string, 0, len(a.groups))
+	for key, group := range a.groups {
+		group.timer.Stop()
+		keys = append(keys, key)
+	}
+	a.mu.Unlock()
+
+	for _, key := range keys {
+		a.closeWindow(key)
+	}
+}
+
+// aggregationWindowFor resolves the window for an environment.
+// DISCORD_AGGREGATION_WINDOWS holds per-environment overrides
+// ("production=10m,staging=2m,development=0s"); DISCORD_AGGREGATION_WINDOW
+// is the fallback for environments not listed.
+func aggregationWindowFor(environment string) time.Duration {
+	window := defaultAggregationWindow
+	if raw := os.Getenv("DISCORD_AGGREGATION_WINDOW"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil {
+			window = d
+		} else {
+			fmt.Fprintf(os.Stderr, "Invalid DISCORD_AGGREGATION_WINDOW=%q: %v\n", raw, err)
+		}
+	}
+
+	for _, pair := range strings.Split(os.Getenv("DISCORD_AGGREGATION_WINDOWS"), ",") {
+		env, raw, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(env), environment) {
+			continue
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid aggregation window for %s: %v\n", env, err)
+			continue
+		}
+		window = d
+	}
+
+	return window
+}
+
+// formatWindow renders a window compactly ("10m", "1h30m")
+func formatWindow(d time.Duration) string {
+	s := d.Round(time.Second).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
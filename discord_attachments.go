@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// maxDiscordFileBytes keeps each attachment under Discord's webhook upload limit
+const maxDiscordFileBytes = 8 * 1024 * 1024
+
+// discordFile is a file uploaded alongside a webhook message
+type discordFile struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// discordAttachment describes an uploaded file in payload_json
+type discordAttachment struct {
+	ID          int    `json:"id"`
+	Filename    string `json:"filename"`
+	Description string `json:"description,omitempty"`
+}
+
+// discordAttachmentsEnabled reports whether full traces are uploaded as files
+// (disable with DISCORD_ATTACHMENTS=false)
+func discordAttachmentsEnabled() bool {
+	return os.Getenv("DISCORD_ATTACHMENTS") != "false"
+}
+
+// buildErrorAttachments returns the full stack trace, details JSON and request
+// snapshot of err as files
+func buildErrorAttachments(err *errorid.ErrorWithID) []discordFile {
+	var files []discordFile
+
+	if err.StackTrace != "" {
+		files = append(files, discordFile{
+			Name:        "stack_trace.txt",
+			ContentType: "text/plain; charset=utf-8",
+			Data:        []byte(err.StackTrace),
+		})
+	}
+
+	if len(err.Details) > 0 {
+		details, _ := sanitizeDetails(err.Details)
+		if data, jsonErr := json.MarshalIndent(details, "", "  "); jsonErr == nil {
+			files = append(files, discordFile{Name: "details.json", ContentType: "application/json", Data: data})
+		}
+	}
+
+	if snapshot := requestSnapshot(err); len(snapshot) > 0 {
+		if data, jsonErr := json.MarshalIndent(snapshot, "", "  "); jsonErr == nil {
+			files = append(files, discordFile{Name: "request.json", ContentType: "application/json", Data: data})
+		}
+	}
+
+	for i := range files {
+		if len(files[i].Data) > maxDiscordFileBytes {
+			files[i].Data = []byte(truncateUTF8(string(files[i].Data), maxDiscordFileBytes))
+		}
+	}
+	return files
+}
+
+// requestSnapshot collects the request-related details of err
+func requestSnapshot(err *errorid.ErrorWithID) map[string]interface{} {
+	requestKeys := []string{"ip_address", "user_agent", "request_id"}
+
+	snapshot := make(map[string]interface{})
+	for key, value := range err.Details {
+		if strings.HasPrefix(key, "http_") || containsString(requestKeys, key) {
+			snapshot[key] = value
+		}
+	}
+	if len(snapshot) == 0 {
+		return nil
+	}
+
+	snapshot["error_id"] = err.ID
+	safe, _ := sanitizeDetails(snapshot)
+	return safe
+}
+
+// attachmentSummary lists attached files for the embed, e.g.
+// "stack_trace.txt (12.3 KB), details.json (512 B)"
+func attachmentSummary(files []discordFile) string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, fmt.Sprintf("`%s` (%s)", file.Name, formatBytes(len(file.Data))))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// formatBytes renders a byte count for humans
+func formatBytes(n int) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// newDiscordMultipartRequest sends message as payload_json with its files
+// as files[n] parts, as required by the webhook API for uploads
+func newDiscordMultipartRequest(method, url string, message DiscordMessage) (*http.Request, error) {
+	message.Attachments = make([]discordAttachment, len(message.Files))
+	for i, file := range message.Files {
+		message.Attachments[i] = discordAttachment{ID: i, Filename: file.Name}
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Discord message: %w", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	payloadHeader := make(textproto.MIMEHeader)
+	payloadHeader.Set("Content-Disposition", `form-data; name="payload_json"`)
+	payloadHeader.Set("Content-Type", "application/json")
+	part, err := writer.CreatePart(payloadHeader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(payload); err != nil {
+		return nil, err
+	}
+
+	for i, file := range message.Files {
+		fileHeader := make(textproto.MIMEHeader)
+		fileHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[%d]"; filename=%q`, i, file.Name))
+		fileHeader.Set("Content-Type", file.ContentType)
+		part, err := writer.CreatePart(fileHeader)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(file.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req, nil
+}
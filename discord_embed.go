@@ -0,0 +1,249 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Discord API limits, counted in characters
+// (https://discord.com/developers/docs/resources/message#embed-object-embed-limits)
+const (
+	discordMaxContent          = 2000
+	discordMaxEmbeds           = 10
+	discordMaxEmbedTitle       = 256
+	discordMaxEmbedDescription = 4096
+	discordMaxEmbedFields      = 25
+	discordMaxFieldName        = 256
+	discordMaxFieldValue       = 1024
+	discordMaxFooterText       = 2048
+	discordMaxEmbedTotal       = 6000
+	discordMaxThreadName       = 100
+)
+
+// emptyFieldValue stands in for blank field names/values, which Discord rejects
+const emptyFieldValue = "\u200b"
+
+// EmbedBuilder assembles an Embed and enforces every Discord embed limit
+// in Build, so callers never have to truncate by hand
+type EmbedBuilder struct {
+	embed Embed
+}
+
+// NewEmbedBuilder starts an embed timestamped now
+func NewEmbedBuilder() *EmbedBuilder {
+	return &EmbedBuilder{embed: Embed{Timestamp: time.Now().UTC().Format(time.RFC3339)}}
+}
+
+// Title sets the embed title
+func (b *EmbedBuilder) Title(title string) *EmbedBuilder {
+	b.embed.Title = title
+	return b
+}
+
+// Description sets the embed description
+func (b *EmbedBuilder) Description(description string) *EmbedBuilder {
+	b.embed.Description = description
+	return b
+}
+
+// Color sets the embed color
+func (b *EmbedBuilder) Color(color int) *EmbedBuilder {
+	b.embed.Color = color
+	return b
+}
+
+// Field appends a field
+func (b *EmbedBuilder) Field(name, value string, inline bool) *EmbedBuilder {
+	b.embed.Fields = append(b.embed.Fields, Field{Name: name, Value: value, Inline: inline})
+	return b
+}
+
+// CodeField appends a field rendering value as a code block
+func (b *EmbedBuilder) CodeField(name, value string) *EmbedBuilder {
+	return b.Field(name, codeBlock(value, discordMaxFieldValue), false)
+}
+
+// Footer sets the footer text
+func (b *EmbedBuilder) Footer(text string) *EmbedBuilder {
+	b.embed.Footer = &Footer{Text: text}
+	return b
+}
+
+// Timestamp sets the embed timestamp
+func (b *EmbedBuilder) Timestamp(t time.Time) *EmbedBuilder {
+	b.embed.Timestamp = t.UTC().Format(time.RFC3339)
+	return b
+}
+
+// Build returns the embed with all limits applied
+func (b *EmbedBuilder) Build() Embed {
+	return limitEmbed(b.embed, discordMaxEmbedTotal)
+}
+
+// limitEmbed enforces the per-field limits, the field count and a total
+// character budget. Over budget, the description is shortened first and
+// then trailing fields are dropped.
+func limitEmbed(embed Embed, budget int) Embed {
+	embed.Title = truncateString(embed.Title, discordMaxEmbedTitle)
+	embed.Description = truncateMarkdown(embed.Description, discordMaxEmbedDescription)
+	if embed.Footer != nil {
+		embed.Footer = &Footer{Text: truncateString(embed.Footer.Text, discordMaxFooterText)}
+	}
+
+	fields := make([]Field, 0, len(embed.Fields))
+	for _, field := range embed.Fields {
+		if len(fields) == discordMaxEmbedFields {
+			break
+		}
+		fields = append(fields, Field{
+			Name:   nonEmpty(truncateMarkdown(field.Name, discordMaxFieldName)),
+			Value:  nonEmpty(truncateMarkdown(field.Value, discordMaxFieldValue)),
+			Inline: field.Inline,
+		})
+	}
+	embed.Fields = fields
+
+	if excess := embedLength(embed) - budget; excess > 0 {
+		keep := utf8.RuneCountInString(embed.Description) - excess
+		if keep < 0 {
+			keep = 0
+		}
+		embed.Description = truncateMarkdown(embed.Description, keep)
+	}
+	for embedLength(embed) > budget && len(embed.Fields) > 0 {
+		embed.Fields = embed.Fields[:len(embed.Fields)-1]
+	}
+	if excess := embedLength(embed) - budget; excess > 0 && embed.Footer != nil {
+		embed.Footer = nil
+	}
+	if excess := embedLength(embed) - budget; excess > 0 {
+		embed.Title = truncateString(embed.Title, utf8.RuneCountInString(embed.Title)-excess)
+	}
+
+	return embed
+}
+
+// embedLength counts the characters Discord includes in the 6000 total
+func embedLength(embed Embed) int {
+	n := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	for _, field := range embed.Fields {
+		n += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if embed.Footer != nil {
+		n += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	return n
+}
+
+// limitDiscordMessage enforces message-level limits: content length,
+// embed count, the combined embed budget and thread name length
+func limitDiscordMessage(message DiscordMessage) DiscordMessage {
+	message.Content = truncateString(message.Content, discordMaxContent)
+	message.ThreadName = truncateString(message.ThreadName, discordMaxThreadName)
+
+	if len(message.Embeds) > discordMaxEmbeds {
+		message.Embeds = message.Embeds[:discordMaxEmbeds]
+	}
+
+	// The 6000 character limit applies to all embeds of a message together
+	budget := discordMaxEmbedTotal
+	embeds := make([]Embed, 0, len(message.Embeds))
+	for _, embed := range message.Embeds {
+		if budget <= 0 {
+			break
+		}
+		embed = limitEmbed(embed, budget)
+		budget -= embedLength(embed)
+		embeds = append(embeds, embed)
+	}
+	message.Embeds = embeds
+
+	return message
+}
+
+// truncateString shortens s to at most maxLen characters (runes), ending with
+// "..." when cut, without ever splitting a multi-byte character
+func truncateString(s string, maxLen int) string {
+	if maxLen <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= maxLen {
+		return s
+	}
+	if maxLen <= 3 {
+		return string([]rune(s)[:maxLen])
+	}
+	return string([]rune(s)[:maxLen-3]) + "..."
+}
+
+// truncateMarkdown is truncateString for markdown escaped with
+// escapeMarkdown: it drops a backslash left without the character it escaped
+func truncateMarkdown(s string, maxLen int) string {
+	if maxLen <= 3 || utf8.RuneCountInString(s) <= maxLen {
+		return truncateString(s, maxLen)
+	}
+	kept := string([]rune(s)[:maxLen-3])
+	// An odd run of trailing backslashes ends in the first half of an escape
+	if trailing := len(kept) - len(strings.TrimRight(kept, `\`)); trailing%2 == 1 {
+		kept = kept[:len(kept)-1]
+	}
+	return kept + "..."
+}
+
+// escapeLimit escapes s with escape and shortens the result to at most
+// maxLen characters, ending with "..." when cut. It cuts the raw text, never
+// the escaped text, so no escape sequence is left half-written.
+func escapeLimit(s string, maxLen int, escape func(string) string) string {
+	escaped := escape(s)
+	if utf8.RuneCountInString(escaped) <= maxLen {
+		return escaped
+	}
+	if maxLen < 3 {
+		return ""
+	}
+	// Longest raw prefix whose escaped form fits before the "..."
+	runes := []rune(s)
+	n := sort.Search(len(runes)+1, func(n int) bool {
+		return utf8.RuneCountInString(escape(string(runes[:n]))) > maxLen-3
+	}) - 1
+	return escape(string(runes[:n])) + "..."
+}
+
+// markdownEscaper backslash-escapes characters Discord treats as markdown
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"_", `\_`,
+	"~", `\~`,
+	"`", "\\`",
+	"|", `\|`,
+	">", `\>`,
+	"#", `\#`,
+	"[", `\[`,
+	"]", `\]`,
+)
+
+// escapeMarkdown makes arbitrary error text render literally
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// codeBlock wraps s in a code block of at most maxLen characters. Backtick
+// runs inside s are broken with a zero-width space so they cannot close
+// the block early.
+func codeBlock(s string, maxLen int) string {
+	const fence = "```"
+	s = strings.ReplaceAll(s, "``", "`\u200b`")
+	s = truncateString(s, maxLen-len(fence)*2-2)
+	return fence + "\n" + s + "\n" + fence
+}
+
+// nonEmpty replaces blank strings with a zero-width space
+func nonEmpty(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return emptyFieldValue
+	}
+	return s
+}
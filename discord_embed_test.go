@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// goldenTime replaces the current time in generated payloads
+var goldenTime = time.Date(2025, 10, 23, 10, 15, 0, 0, time.UTC)
+
+const goldenTimestamp = "2025-10-23T10:15:00Z"
+
+// discordPayload returns the JSON body newDiscordRequest sends for message
+func discordPayload(t *testing.T, message DiscordMessage) json.RawMessage {
+	t.Helper()
+	req, err := newDiscordRequest(http.MethodPost, "https://discord.test/api/webhooks/1/token", message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// checkEmbedLimits fails the test when embed breaks a Discord limit
+func checkEmbedLimits(t *testing.T, embed Embed) {
+	t.Helper()
+	if n := embedLength(embed); n > discordMaxEmbedTotal {
+		t.Errorf("embed has %d characters, limit %d", n, discordMaxEmbedTotal)
+	}
+	if n := utf8.RuneCountInString(embed.Title); n > discordMaxEmbedTitle {
+		t.Errorf("title has %d characters", n)
+	}
+	if n := utf8.RuneCountInString(embed.Description); n > discordMaxEmbedDescription {
+		t.Errorf("description has %d characters", n)
+	}
+	if len(embed.Fields) > discordMaxEmbedFields {
+		t.Errorf("embed has %d fields", len(embed.Fields))
+	}
+	for _, field := range embed.Fields {
+		if utf8.RuneCountInString(field.Name) > discordMaxFieldName || utf8.RuneCountInString(field.Value) > discordMaxFieldValue {
+			t.Errorf("field %q exceeds the field limits", field.Name)
+		}
+		if strings.TrimSpace(field.Name) == "" || strings.TrimSpace(field.Value) == "" {
+			t.Errorf("field has a blank name or value")
+		}
+		if !utf8.ValidString(field.Name) || !utf8.ValidString(field.Value) {
+			t.Errorf("field %q was cut inside a character", field.Name)
+		}
+	}
+	if !utf8.ValidString(embed.Title) || !utf8.ValidString(embed.Description) {
+		t.Errorf("title or description was cut inside a character")
+	}
+}
+
+func TestBuildErrorMessageGolden(t *testing.T) {
+	useFixedRuntimeMetadata(t)
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("DISCORD_ATTACHMENTS", "false")
+
+	tests := []struct {
+		name string
+		err  *errorid.ErrorWithID
+	}{
+		{
+			name: "discord/database_error",
+			err: &errorid.ErrorWithID{
+				ID:       "ERR-20251023-A3F9B2",
+				Original: errors.New("connection to database timed out after 30s"),
+				Context:  "failed to connect to PostgreSQL",
+				Details: map[string]interface{}{
+					"category":    "database",
+					"http_status": 503,
+					"http_method": "GET",
+					"http_route":  "/api/error/database",
+					"request_id":  "req-123",
+					"database":    "postgres",
+					"port":        5432,
+				},
+				StackTrace: "goroutine 1 [running]:\nmain.(*DatabaseService).Connect()\n\t/app/services.go:19 +0x1d",
+			},
+		},
+		{
+			name: "discord/markdown_escaping",
+			err: &errorid.ErrorWithID{
+				ID:       "ERR-20251023-B4C5D6",
+				Original: errors.New("*bold* _italic_ `code` ~~strike~~ @everyone <@&123>"),
+				Context:  "[click](https://example.com) > quote # heading",
+				Details: map[string]interface{}{
+					"user_agent": "curl/8.0 | *pipe*",
+				},
+				StackTrace: "panic: ``` breaks out of code blocks ```",
+			},
+		},
+		{
+			name: "discord/truncated",
+			err: &errorid.ErrorWithID{
+				ID:       "ERR-20251023-C7D8E9",
+				Original: errors.New(strings.Repeat("é", 5000)),
+				Context:  strings.Repeat("context ", 100),
+				Details: map[string]interface{}{
+					"payload": strings.Repeat("x", 2000),
+					"emoji":   strings.Repeat("🔥", 600),
+				},
+				StackTrace: strings.Repeat("main.handler()\n\t/app/handlers.go:42\n", 200),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := buildErrorMessage(tt.err)
+			for i := range message.Embeds {
+				checkEmbedLimits(t, message.Embeds[i])
+				message.Embeds[i].Timestamp = goldenTimestamp
+			}
+			assertGolden(t, tt.name, discordPayload(t, message))
+		})
+	}
+}
+
+func TestEmbedBuilderGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func() *EmbedBuilder
+	}{
+		{
+			name: "embed/oversized_parts",
+			build: func() *EmbedBuilder {
+				return NewEmbedBuilder().
+					Title(strings.Repeat("T", 300)).
+					Description(strings.Repeat("d", 5000)).
+					Field(strings.Repeat("n", 300), strings.Repeat("v", 2000), false).
+					Footer(strings.Repeat("f", 3000))
+			},
+		},
+		{
+			name: "embed/too_many_fields",
+			build: func() *EmbedBuilder {
+				b := NewEmbedBuilder().Title("Many fields").Description("Fields past the limit are dropped")
+				for i := 0; i < 30; i++ {
+					b.Field(strings.Repeat(string(rune('a'+i%26)), 10), strings.Repeat("v", 400), true)
+				}
+				return b
+			},
+		},
+		{
+			name: "embed/empty_values",
+			build: func() *EmbedBuilder {
+				return NewEmbedBuilder().Title("Blank fields").Field("", "value", true).Field("name", "   ", true)
+			},
+		},
+		{
+			name: "embed/multibyte_boundaries",
+			build: func() *EmbedBuilder {
+				return NewEmbedBuilder().
+					Title(strings.Repeat("日本", 200)).
+					Field("Emoji", strings.Repeat("🚨", 1100), false).
+					CodeField("Stack Trace", strings.Repeat("ß", 2000))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embed := tt.build().Timestamp(goldenTime).Build()
+			checkEmbedLimits(t, embed)
+			assertGolden(t, tt.name, embed)
+		})
+	}
+}
+
+func TestLimitDiscordMessageGolden(t *testing.T) {
+	var embeds []Embed
+	for i := 0; i < 12; i++ {
+		embeds = append(embeds, Embed{Title: "Embed", Description: strings.Repeat("x", 1000), Timestamp: goldenTimestamp})
+	}
+	message := DiscordMessage{
+		Content:    strings.Repeat("c", 2100),
+		ThreadName: strings.Repeat("t", 150),
+		Embeds:     embeds,
+	}
+
+	limited := limitDiscordMessage(message)
+	total := 0
+	for _, embed := range limited.Embeds {
+		checkEmbedLimits(t, embed)
+		total += embedLength(embed)
+	}
+	if total > discordMaxEmbedTotal {
+		t.Errorf("embeds have %d characters together, limit %d", total, discordMaxEmbedTotal)
+	}
+	assertGolden(t, "message/shared_embed_budget", discordPayload(t, limited))
+}
+
+func TestEscapeLimit(t *testing.T) {
+	tests := []struct {
+		in     string
+		maxLen int
+		escape func(string) string
+		want   string
+	}{
+		{in: "AT&T", maxLen: 20, escape: escapeSlack, want: "AT&amp;T"},
+		{in: "AT&T & co", maxLen: 10, escape: escapeSlack, want: "AT&amp;..."},
+		{in: "AT&T & co", maxLen: 8, escape: escapeSlack, want: "AT..."},
+		{in: `a\b\c`, maxLen: 5, escape: markdownEscaper.Replace, want: "a..."},
+		{in: "éééé", maxLen: 4, escape: escapeSlack, want: "éééé"},
+	}
+	for _, tt := range tests {
+		got := escapeLimit(tt.in, tt.maxLen, tt.escape)
+		if got != tt.want {
+			t.Errorf("escapeLimit(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+		}
+		if n := utf8.RuneCountInString(got); n > tt.maxLen {
+			t.Errorf("escapeLimit(%q, %d) has %d characters", tt.in, tt.maxLen, n)
+		}
+	}
+}
+
+func TestTruncateMarkdownKeepsEscapesWhole(t *testing.T) {
+	tests := []struct {
+		in     string
+		maxLen int
+		want   string
+	}{
+		{in: `ab\*cd`, maxLen: 10, want: `ab\*cd`},
+		{in: `ab\*cdef`, maxLen: 6, want: `ab...`},
+		{in: `a\\\\bcdef`, maxLen: 8, want: `a\\\\...`},
+		{in: `a\\\\bcdef`, maxLen: 7, want: `a\\...`},
+	}
+	for _, tt := range tests {
+		if got := truncateMarkdown(tt.in, tt.maxLen); got != tt.want {
+			t.Errorf("truncateMarkdown(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// defaultLiveUpdateTTL is how long a group can stay quiet before a new message is posted
+const defaultLiveUpdateTTL = time.Hour
+
+// liveMessage is the Discord message currently representing one error group
+type liveMessage struct {
+	messageID   string
+	threadID    string
+	base        DiscordMessage
+	count       int
+	firstSeen   time.Time
+	lastSeen    time.Time
+	lastErrorID string
+	editPending bool
+}
+
+// liveMessageTracker remembers posted messages per target and fingerprint so
+// later occurrences edit the existing message instead of posting new ones
+type liveMessageTracker struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	messages map[string]*liveMessage
+}
+
+// newLiveMessageTracker returns a tracker when DISCORD_LIVE_UPDATES=true, nil otherwise.
+// DISCORD_LIVE_UPDATE_TTL controls when a quiet group starts a fresh message.
+func newLiveMessageTracker() *liveMessageTracker {
+	if os.Getenv("DISCORD_LIVE_UPDATES") != "true" {
+		return nil
+	}
+
+	ttl := defaultLiveUpdateTTL
+	if raw := os.Getenv("DISCORD_LIVE_UPDATE_TTL"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			ttl = d
+		} else {
+			fmt.Fprintf(os.Stderr, "Invalid DISCORD_LIVE_UPDATE_TTL=%q, using %s\n", raw, ttl)
+		}
+	}
+
+	return &liveMessageTracker{
+		ttl:      ttl,
+		messages: make(map[string]*liveMessage),
+	}
+}
+
+// Observe records an occurrence. It returns post=true when a new message must
+// be posted, and edit=true when an edit must be queued; both are false when an
+// edit is already queued and will pick up this occurrence.
+func (t *liveMessageTracker) Observe(key string, err *errorid.ErrorWithID, base DiscordMessage) (post, edit bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweep(now)
+
+	if msg, ok := t.messages[key]; ok {
+		msg.count++
+		msg.lastSeen = now
+		msg.lastErrorID = err.ID
+		if msg.editPending {
+			return false, false
+		}
+		msg.editPending = true
+		return false, true
+	}
+
+	t.messages[key] = &liveMessage{
+		base:        base,
+		count:       1,
+		firstSeen:   now,
+		lastSeen:    now,
+		lastErrorID: err.ID,
+	}
+	return true, false
+}
+
+// Posted stores the IDs Discord returned for a group's message
+func (t *liveMessageTracker) Posted(key, messageID, threadID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if msg, ok := t.messages[key]; ok {
+		msg.messageID = messageID
+		msg.threadID = threadID
+	}
+}
+
+// Forget drops a group, e.g. after its message was deleted in Discord
+func (t *liveMessageTracker) Forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.messages, key)
+}
+
+// snapshot renders the group's current state and clears the pending flag,
+// so occurrences arriving after this point queue a new edit. messageID is
+// empty when the group has no posted message: the queue is ordered, so the
+// post already ran and failed or was dropped.
+func (t *liveMessageTracker) snapshot(key string) (messageID, threadID string, message DiscordMessage, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	msg, found := t.messages[key]
+	if !found {
+		return "", "", DiscordMessage{}, false
+	}
+	msg.editPending = false
+	return msg.messageID, msg.threadID, msg.render(), true
+}
+
+// sweep drops groups that have been quiet for longer than the TTL; callers hold t.mu
+func (t *liveMessageTracker) sweep(now time.Time) {
+	for key, msg := range t.messages {
+		if now.Sub(msg.lastSeen) > t.ttl {
+			delete(t.messages, key)
+		}
+	}
+}
+
+// render returns the original message updated with occurrence statistics
+func (m *liveMessage) render() DiscordMessage {
+	message := m.base
+	if len(message.Embeds) == 0 {
+		return message
+	}
+
+	embed := message.Embeds[0]
+	embed.Fields = append([]Field{
+		{
+			Name:   "Occurrences",
+			Value:  fmt.Sprintf("**%d** (first <t:%d:R>, last <t:%d:R>)", m.count, m.firstSeen.Unix(), m.lastSeen.Unix()),
+			Inline: true,
+		},
+		{
+			Name:   "Latest Error ID",
+			Value:  m.lastErrorID,
+			Inline: true,
+		},
+	}, embed.Fields...)
+	embed.Timestamp = m.lastSeen.UTC().Format(time.RFC3339)
+
+	message.Embeds = append([]Embed{embed}, message.Embeds[1:]...)
+	message.ThreadName = ""
+	// Omitting attachments keeps the files uploaded with the original post
+	message.Files = nil
+	message.Attachments = nil
+	return message
+}
+
+// editMessageURL returns the webhook endpoint for editing a posted message
+func editMessageURL(webhookURL, messageID, threadID string) string {
+	base := webhookURL
+	query := ""
+	if i := strings.Index(base, "?"); i >= 0 {
+		base, query = base[:i], base[i:]
+	}
+	editURL := strings.TrimSuffix(base, "/") + "/messages/" + messageID + query
+	if threadID != "" {
+		editURL = withQuery(editURL, "thread_id", threadID)
+	}
+	return editURL
+}
+
+// sendLiveUpdate posts the first occurrence of a group or queues an edit of
+// its existing message with the latest count, last seen time and error ID.
+// When the group has no message to edit (the post failed or was dropped),
+// the edit posts a fresh message instead. It returns the outcome channel of the queued request, or nil when the
+// occurrence is picked up by an edit that is already queued.
+func (d *DiscordWebhook) sendLiveUpdate(target discordTarget, fingerprint, threadName string, err *errorid.ErrorWithID, message DiscordMessage) <-chan error {
+	key := target.URL + "|" + fingerprint
+	onPosted := func(messageID, channelID string) {
+		threadID := ""
+		if target.Forum {
+			threadID = channelID
+		}
+		d.live.Posted(key, messageID, threadID)
+	}
+
+	post, edit := d.live.Observe(key, err, message)
+	if post {
+		return d.sendToDiscord(target, fingerprint, threadName, message, onPosted)
+	}
+	if !edit {
+		return nil
+	}
+
+	// repost is set when there is no message to edit and the group's
+	// current state is posted as a fresh message instead
+	var repost *discordDelivery
+	result := make(chan error, 1)
+	getDiscordQueue(target.URL, d.httpClient).Enqueue(discordDelivery{
+		label: fmt.Sprintf("update %s (%s)", fingerprint, err.ID),
+		build: func() (*http.Request, error) {
+			messageID, threadID, updated, ok := d.live.snapshot(key)
+			if !ok {
+				// The group expired or its message was deleted meanwhile
+				d.live.Observe(key, err, message)
+				_, _, updated, _ = d.live.snapshot(key)
+			}
+			if messageID == "" {
+				fresh := d.postDelivery(target, fingerprint, threadName, updated, onPosted)
+				repost = &fresh
+				return repost.build()
+			}
+			repost = nil
+			return newDiscordRequest(http.MethodPatch, editMessageURL(target.URL, messageID, threadID), updated)
+		},
+		onSuccess: func(body []byte) {
+			if repost != nil && repost.onSuccess != nil {
+				repost.onSuccess(body)
+			}
+		},
+		onFailure: func(status int, body []byte) bool {
+			if repost != nil {
+				return repost.onFailure != nil && repost.onFailure(status, body)
+			}
+			// Message was deleted: the next occurrence posts a new one
+			if status == http.StatusNotFound {
+				d.live.Forget(key)
+			}
+			return false
+		},
+		onDone: func(err error) { result <- err },
+	})
+	return result
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// AllowedMentions restricts who a message may ping. Parse is always sent
+// (even empty) so @everyone, @here and role text inside error messages
+// never notify anyone.
+type AllowedMentions struct {
+	Parse []string `json:"parse"`
+	Roles []string `json:"roles,omitempty"`
+	Users []string `json:"users,omitempty"`
+}
+
+// MentionRule pings roles/users for errors matching Match
+type MentionRule struct {
+	Name  string     `json:"name"`
+	Match ErrorMatch `json:"match"`
+	Roles []string   `json:"roles,omitempty"`
+	Users []string   `json:"users,omitempty"`
+	// IgnoreQuietHours pings even during quiet hours (e.g. for paging)
+	IgnoreQuietHours bool `json:"ignore_quiet_hours,omitempty"`
+}
+
+// QuietHours is a daily "HH:MM" window in which pings are suppressed;
+// windows may wrap midnight ("22:00"-"07:00")
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// DiscordMentionConfig is the content of DISCORD_MENTIONS_FILE
+type DiscordMentionConfig struct {
+	Timezone   string        `json:"timezone,omitempty"`
+	QuietHours *QuietHours   `json:"quiet_hours,omitempty"`
+	Rules      []MentionRule `json:"rules"`
+}
+
+// discordMentions decides who to ping for an error
+type discordMentions struct {
+	config   DiscordMentionConfig
+	location *time.Location
+	now      func() time.Time
+}
+
+// loadDiscordMentions reads DISCORD_MENTIONS_FILE; without it nobody is pinged
+func loadDiscordMentions() (*discordMentions, error) {
+	m := &discordMentions{location: time.UTC, now: time.Now}
+
+	path := os.Getenv("DISCORD_MENTIONS_FILE")
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, fmt.Errorf("failed to read Discord mentions file: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.config); err != nil {
+		return m, fmt.Errorf("failed to parse Discord mentions file %s: %w", path, err)
+	}
+
+	if m.config.Timezone != "" {
+		location, err := time.LoadLocation(m.config.Timezone)
+		if err != nil {
+			return m, fmt.Errorf("invalid timezone in Discord mentions file: %w", err)
+		}
+		m.location = location
+	}
+	if q := m.config.QuietHours; q != nil {
+		if _, err := parseClock(q.Start); err != nil {
+			return m, fmt.Errorf("invalid quiet_hours.start: %w", err)
+		}
+		if _, err := parseClock(q.End); err != nil {
+			return m, fmt.Errorf("invalid quiet_hours.end: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Apply sets the mention content and allowed_mentions of message for err
+func (m *discordMentions) Apply(err *errorid.ErrorWithID, message *DiscordMessage) {
+	var roles, users []string
+	quiet := m.inQuietHours()
+
+	for _, rule := range m.config.Rules {
+		if quiet && !rule.IgnoreQuietHours {
+			continue
+		}
+		if !rule.Match.Matches(err) {
+			continue
+		}
+		roles = appendUniqueStrings(roles, rule.Roles...)
+		users = appendUniqueStrings(users, rule.Users...)
+	}
+
+	message.AllowedMentions = &AllowedMentions{Parse: []string{}, Roles: roles, Users: users}
+	if len(roles) == 0 && len(users) == 0 {
+		return
+	}
+
+	pings := make([]string, 0, len(roles)+len(users))
+	for _, role := range roles {
+		pings = append(pings, "<@&"+role+">")
+	}
+	for _, user := range users {
+		pings = append(pings, "<@"+user+">")
+	}
+	message.Content = strings.TrimSpace(strings.Join(pings, " ") + " " + message.Content)
+}
+
+// inQuietHours reports whether the current local time is inside quiet hours
+func (m *discordMentions) inQuietHours() bool {
+	q := m.config.QuietHours
+	if q == nil {
+		return false
+	}
+	start, _ := parseClock(q.Start)
+	end, _ := parseClock(q.End)
+
+	now := m.now().In(m.location)
+	minute := now.Hour()*60 + now.Minute()
+
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// parseClock converts "HH:MM" to minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// appendUniqueStrings appends values not already present in list
+func appendUniqueStrings(list []string, values ...string) []string {
+	for _, value := range values {
+		if value != "" && !containsString(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDiscordQueueSize = 100
+	maxDiscordAttempts      = 5
+	// maxDiscordRateLimitWait bounds how long one delivery waits out 429s,
+	// which do not count as attempts
+	maxDiscordRateLimitWait = 10 * time.Minute
+)
+
+// Drop policies applied when a webhook queue is full
+const (
+	dropOldest = "oldest"
+	dropNewest = "newest"
+)
+
+// discordGlobalLimit is shared by every webhook queue: a global 429 from
+// Discord pauses all deliveries, not just the webhook that hit it
+var discordGlobalLimit rateLimitGate
+
+// rateLimitGate blocks callers until a rate limit has reset
+type rateLimitGate struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// Extend pushes the reset time out to now+d if that is later
+func (g *rateLimitGate) Extend(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if until := time.Now().Add(d); until.After(g.until) {
+		g.until = until
+	}
+}
+
+// Wait returns how long a caller still has to wait
+func (g *rateLimitGate) Wait() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return time.Until(g.until)
+}
+
+// discordDelivery is one request waiting in a webhook queue.
+// The request is built right before each attempt so retries get a fresh body.
+type discordDelivery struct {
+	label string
+	build func() (*http.Request, error)
+	// onSuccess receives the response body of a successful request
+	onSuccess func(body []byte)
+	// onFailure may repair state after a 4xx response and ask for a retry
+	onFailure func(status int, body []byte) (retry bool)
+	// onDone receives the final outcome: nil once Discord accepted the
+	// message, or why it was dropped or given up on
+	onDone func(err error)
+}
+
+// finish reports the delivery's outcome to onDone, if set
+func (d discordDelivery) finish(err error) {
+	if d.onDone != nil {
+		d.onDone(err)
+	}
+}
+
+// webhookQueue delivers requests for a single webhook in order, honoring
+// Discord's bucket and global rate limits
+type webhookQueue struct {
+	url        string
+	httpClient *http.Client
+	capacity   int
+	dropPolicy string
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	items        []discordDelivery
+	dropped      int
+	totalDropped int
+	closed       bool
+
+	bucket rateLimitGate
+	done   chan struct{}
+}
+
+var (
+	discordQueuesMu sync.Mutex
+	discordQueues   = make(map[string]*webhookQueue)
+)
+
+// getDiscordQueue returns the shared queue for a webhook URL, starting it on first use
+func getDiscordQueue(webhookURL string, httpClient *http.Client) *webhookQueue {
+	discordQueuesMu.Lock()
+	defer discordQueuesMu.Unlock()
+
+	if q, ok := discordQueues[webhookURL]; ok {
+		return q
+	}
+	q := newWebhookQueue(webhookURL, httpClient, envInt("DISCORD_QUEUE_SIZE", defaultDiscordQueueSize), os.Getenv("DISCORD_QUEUE_DROP_POLICY"))
+	discordQueues[webhookURL] = q
+	return q
+}
+
+// closeDiscordQueues drains every webhook queue, waiting at most timeout
+func closeDiscordQueues(timeout time.Duration) {
+	discordQueuesMu.Lock()
+	queues := make([]*webhookQueue, 0, len(discordQueues))
+	for _, q := range discordQueues {
+		queues = append(queues, q)
+	}
+	discordQueuesMu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	for _, q := range queues {
+		q.Close(time.Until(deadline))
+	}
+}
+
+// newWebhookQueue creates a queue and starts its delivery worker
+func newWebhookQueue(webhookURL string, httpClient *http.Client, capacity int, dropPolicy string) *webhookQueue {
+	if capacity <= 0 {
+		capacity = defaultDiscordQueueSize
+	}
+	if dropPolicy != dropNewest {
+		dropPolicy = dropOldest
+	}
+
+	q := &webhookQueue{
+		url:        webhookURL,
+		httpClient: httpClient,
+		capacity:   capacity,
+		dropPolicy: dropPolicy,
+		done:       make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	go q.run()
+	return q
+}
+
+// Enqueue adds a delivery, applying the drop policy when the queue is full
+func (q *webhookQueue) Enqueue(delivery discordDelivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		fmt.Fprintf(os.Stderr, "Discord queue closed, dropping notification: %s\n", delivery.label)
+		delivery.finish(fmt.Errorf("Discord queue closed"))
+		return
+	}
+
+	if len(q.items) >= q.capacity {
+		q.dropped++
+		q.totalDropped++
+		if q.dropPolicy == dropNewest {
+			fmt.Fprintf(os.Stderr, "Discord queue full, dropping notification: %s\n", delivery.label)
+			delivery.finish(fmt.Errorf("Discord queue full"))
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Discord queue full, dropping notification: %s\n", q.items[0].label)
+		q.items[0].finish(fmt.Errorf("Discord queue full"))
+		q.items = q.items[1:]
+	}
+
+	q.items = append(q.items, delivery)
+	q.cond.Signal()
+}
+
+// Dropped returns the number of notifications dropped since the queue started
+func (q *webhookQueue) Dropped() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.totalDropped
+}
+
+// Close stops accepting deliveries and waits up to timeout for the queue to drain
+func (q *webhookQueue) Close(timeout time.Duration) {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+	case <-time.After(timeout):
+		fmt.Fprintf(os.Stderr, "Discord queue did not drain within %s, %d notifications lost\n", timeout, q.pending())
+	}
+}
+
+// pending returns the number of queued deliveries
+func (q *webhookQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// next blocks until a delivery is available; ok is false once closed and drained
+func (q *webhookQueue) next() (discordDelivery, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 {
+		// Report drops once the backlog has cleared
+		if q.dropped > 0 && !q.closed {
+			q.items = append(q.items, q.dropReport(q.dropped))
+			q.dropped = 0
+			break
+		}
+		if q.closed {
+			return discordDelivery{}, false
+		}
+		q.cond.Wait()
+	}
+
+	delivery := q.items[0]
+	q.items = q.items[1:]
+	return delivery, true
+}
+
+// run is the queue's single delivery worker
+func (q *webhookQueue) run() {
+	defer close(q.done)
+	for {
+		delivery, ok := q.next()
+		if !ok {
+			return
+		}
+		q.deliver(delivery)
+	}
+}
+
+// deliver sends one delivery, retrying on 429 and transient failures. A 429
+// is waited out without using up an attempt.
+func (q *webhookQueue) deliver(delivery discordDelivery) {
+	var rateLimited time.Duration
+	for attempt := 1; attempt <= maxDiscordAttempts; attempt++ {
+		q.waitForRateLimit()
+
+		req, err := delivery.build()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create Discord request: %v\n", err)
+			delivery.finish(err)
+			return
+		}
+
+		resp, err := q.httpClient.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send to Discord (attempt %d): %v\n", attempt, err)
+			time.Sleep(backoff(attempt))
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+
+		q.updateBucket(resp.Header)
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			retryAfter, global := parseRetryAfter(resp.Header, body)
+			if global {
+				discordGlobalLimit.Extend(retryAfter)
+			} else {
+				q.bucket.Extend(retryAfter)
+			}
+			rateLimited += retryAfter
+			if rateLimited > maxDiscordRateLimitWait {
+				fmt.Fprintf(os.Stderr, "Giving up on Discord notification after %s rate limited: %s\n", rateLimited, delivery.label)
+				delivery.finish(fmt.Errorf("giving up on Discord notification after %s rate limited", rateLimited))
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Discord rate limited (global=%v), retrying in %s\n", global, retryAfter)
+			attempt--
+		case resp.StatusCode >= 500:
+			fmt.Fprintf(os.Stderr, "Discord webhook returned error status: %d (attempt %d)\n", resp.StatusCode, attempt)
+			time.Sleep(backoff(attempt))
+		case resp.StatusCode >= 400:
+			if delivery.onFailure != nil && delivery.onFailure(resp.StatusCode, body) {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Discord webhook returned error status: %d: %s\n", resp.StatusCode, strings.TrimSpace(string(body)))
+			delivery.finish(fmt.Errorf("Discord webhook returned error status: %d", resp.StatusCode))
+			return
+		default:
+			if delivery.onSuccess != nil {
+				delivery.onSuccess(body)
+			}
+			fmt.Printf("Error notification sent to Discord: %s\n", delivery.label)
+			delivery.finish(nil)
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Giving up on Discord notification after %d attempts: %s\n", maxDiscordAttempts, delivery.label)
+	delivery.finish(fmt.Errorf("giving up on Discord notification after %d attempts", maxDiscordAttempts))
+}
+
+// waitForRateLimit sleeps until both the global and the bucket limit allow a request
+func (q *webhookQueue) waitForRateLimit() {
+	for {
+		wait := discordGlobalLimit.Wait()
+		if bucketWait := q.bucket.Wait(); bucketWait > wait {
+			wait = bucketWait
+		}
+		if wait <= 0 {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
+
+// updateBucket pauses the queue when the X-RateLimit-* headers say the bucket is exhausted
+func (q *webhookQueue) updateBucket(header http.Header) {
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+	if resetAfter, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64); err == nil {
+		q.bucket.Extend(secondsToDuration(resetAfter))
+	}
+}
+
+// dropReport builds the notice posted after notifications were dropped
+func (q *webhookQueue) dropReport(count int) discordDelivery {
+	message := DiscordMessage{
+		Content: fmt.Sprintf("⚠️ %d error notification(s) were dropped because the Discord queue was full (limit %d, policy drop-%s). Check ELK for the full list.",
+			count, q.capacity, q.dropPolicy),
+	}
+	return discordDelivery{
+		label: fmt.Sprintf("%d dropped notifications", count),
+		build: func() (*http.Request, error) { return newDiscordRequest(http.MethodPost, q.url, message) },
+	}
+}
+
+// parseRetryAfter reads retry_after/global from a 429 body, falling back to headers
+func parseRetryAfter(header http.Header, body []byte) (time.Duration, bool) {
+	var payload struct {
+		RetryAfter float64 `json:"retry_after"`
+		Global     bool    `json:"global"`
+	}
+	_ = json.Unmarshal(body, &payload)
+
+	global := payload.Global || strings.EqualFold(header.Get("X-RateLimit-Global"), "true")
+	if payload.RetryAfter > 0 {
+		return secondsToDuration(payload.RetryAfter), global
+	}
+	if seconds, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil {
+		return secondsToDuration(seconds), global
+	}
+	return time.Second, global
+}
+
+// secondsToDuration converts Discord's fractional seconds to a duration
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// backoff returns the exponential delay before retry attempt n
+func backoff(attempt int) time.Duration {
+	return time.Duration(1<<uint(attempt-1)) * 500 * time.Millisecond
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDiscord is a local stand-in for a Discord webhook that records the
+// bodies it receives and answers with the queued responses, then 204
+type fakeDiscord struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	bodies    []string
+	responses []func(w http.ResponseWriter)
+	// hold blocks every request until it is closed, if set
+	hold chan struct{}
+}
+
+func newFakeDiscord(t *testing.T, responses ...func(w http.ResponseWriter)) *fakeDiscord {
+	f := &fakeDiscord{responses: responses}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeDiscord) serve(w http.ResponseWriter, r *http.Request) {
+	if f.hold != nil {
+		<-f.hold
+	}
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	f.bodies = append(f.bodies, string(body))
+	var respond func(w http.ResponseWriter)
+	if len(f.responses) > 0 {
+		respond, f.responses = f.responses[0], f.responses[1:]
+	}
+	f.mu.Unlock()
+
+	if respond != nil {
+		respond(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeDiscord) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.bodies...)
+}
+
+// testDelivery posts content to url and reports the outcome on the returned channel
+func testDelivery(url, content string) (discordDelivery, <-chan error) {
+	result := make(chan error, 1)
+	return discordDelivery{
+		label: content,
+		build: func() (*http.Request, error) {
+			return newDiscordRequest(http.MethodPost, url, DiscordMessage{Content: content})
+		},
+		onDone: func(err error) { result <- err },
+	}, result
+}
+
+func waitResult(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery did not finish")
+		return nil
+	}
+}
+
+func TestWebhookQueueRetriesAfterRateLimit(t *testing.T) {
+	server := newFakeDiscord(t, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message":"You are being rate limited.","retry_after":0.2,"global":false}`)
+	})
+	queue := newWebhookQueue(server.URL, server.Client(), 10, dropOldest)
+	defer queue.Close(time.Second)
+
+	delivery, result := testDelivery(server.URL, "rate limited")
+	start := time.Now()
+	queue.Enqueue(delivery)
+
+	if err := waitResult(t, result); err != nil {
+		t.Fatalf("delivery failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("retried after %s, before retry_after", elapsed)
+	}
+	if got := len(server.received()); got != 2 {
+		t.Errorf("webhook received %d requests, want 2", got)
+	}
+}
+
+func TestWebhookQueueRateLimitsDoNotUseUpAttempts(t *testing.T) {
+	rateLimited := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message":"You are being rate limited.","retry_after":0.01,"global":false}`)
+	}
+	var responses []func(w http.ResponseWriter)
+	for i := 0; i < maxDiscordAttempts+2; i++ {
+		responses = append(responses, rateLimited)
+	}
+	server := newFakeDiscord(t, responses...)
+	queue := newWebhookQueue(server.URL, server.Client(), 10, dropOldest)
+	defer queue.Close(time.Second)
+
+	delivery, result := testDelivery(server.URL, "rate limited")
+	queue.Enqueue(delivery)
+
+	if err := waitResult(t, result); err != nil {
+		t.Fatalf("delivery failed after %d rate limits: %v", len(responses), err)
+	}
+	if got, want := len(server.received()), len(responses)+1; got != want {
+		t.Errorf("webhook received %d requests, want %d", got, want)
+	}
+}
+
+func TestWebhookQueueWaitsForExhaustedBucket(t *testing.T) {
+	server := newFakeDiscord(t, func(w http.ResponseWriter) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset-After", "0.2")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	queue := newWebhookQueue(server.URL, server.Client(), 10, dropOldest)
+	defer queue.Close(time.Second)
+
+	first, firstResult := testDelivery(server.URL, "first")
+	second, secondResult := testDelivery(server.URL, "second")
+	queue.Enqueue(first)
+	queue.Enqueue(second)
+
+	if err := waitResult(t, firstResult); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := waitResult(t, secondResult); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("second request sent %s after the first, before the bucket reset", elapsed)
+	}
+}
+
+func TestWebhookQueueReportsClientErrors(t *testing.T) {
+	server := newFakeDiscord(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"message":"Invalid Form Body"}`)
+	})
+	queue := newWebhookQueue(server.URL, server.Client(), 10, dropOldest)
+	defer queue.Close(time.Second)
+
+	delivery, result := testDelivery(server.URL, "bad")
+	queue.Enqueue(delivery)
+
+	err := waitResult(t, result)
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("got %v, want the 400 reported", err)
+	}
+	if got := len(server.received()); got != 1 {
+		t.Errorf("webhook received %d requests, want no retry of a 400", got)
+	}
+}
+
+func TestWebhookQueueDropPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		dropped []string
+		sent    []string
+	}{
+		{policy: dropOldest, dropped: []string{"queued-1", "queued-2"}, sent: []string{"in-flight", "queued-3", "queued-4"}},
+		{policy: dropNewest, dropped: []string{"queued-3", "queued-4"}, sent: []string{"in-flight", "queued-1", "queued-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			server := newFakeDiscord(t)
+			server.hold = make(chan struct{})
+			queue := newWebhookQueue(server.URL, server.Client(), 2, tt.policy)
+			defer queue.Close(time.Second)
+
+			results := make(map[string]<-chan error)
+			inFlight, inFlightResult := testDelivery(server.URL, "in-flight")
+			results["in-flight"] = inFlightResult
+			queue.Enqueue(inFlight)
+			// Wait until the worker has taken the first delivery off the queue
+			for queue.pending() > 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			for i := 1; i <= 4; i++ {
+				label := fmt.Sprintf("queued-%d", i)
+				delivery, result := testDelivery(server.URL, label)
+				results[label] = result
+				queue.Enqueue(delivery)
+			}
+			if got := queue.Dropped(); got != 2 {
+				t.Errorf("Dropped() = %d, want 2", got)
+			}
+
+			for _, label := range tt.dropped {
+				if err := waitResult(t, results[label]); err == nil || !strings.Contains(err.Error(), "queue full") {
+					t.Errorf("%s: got %v, want a queue full error", label, err)
+				}
+			}
+			close(server.hold)
+			for _, label := range tt.sent {
+				if err := waitResult(t, results[label]); err != nil {
+					t.Errorf("%s: %v", label, err)
+				}
+			}
+
+			// The drop report follows once the backlog has cleared
+			deadline := time.Now().Add(5 * time.Second)
+			for len(server.received()) < len(tt.sent)+1 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			bodies := server.received()
+			if len(bodies) != len(tt.sent)+1 {
+				t.Fatalf("webhook received %d requests, want %d", len(bodies), len(tt.sent)+1)
+			}
+			for i, label := range tt.sent {
+				if !strings.Contains(bodies[i], label) {
+					t.Errorf("request %d = %s, want %s", i, bodies[i], label)
+				}
+			}
+			if report := bodies[len(bodies)-1]; !strings.Contains(report, "2 error notification(s) were dropped") || !strings.Contains(report, "drop-"+tt.policy) {
+				t.Errorf("drop report = %s", report)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   time.Duration
+		global bool
+	}{
+		{name: "body", body: `{"retry_after":1.5,"global":true}`, want: 1500 * time.Millisecond, global: true},
+		{name: "header", header: http.Header{"Retry-After": {"3"}, "X-Ratelimit-Global": {"true"}}, want: 3 * time.Second, global: true},
+		{name: "default", want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			got, global := parseRetryAfter(header, []byte(tt.body))
+			if got != tt.want || global != tt.global {
+				t.Errorf("got %s, %v; want %s, %v", got, global, tt.want, tt.global)
+			}
+		})
+	}
+}
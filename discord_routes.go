@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// DiscordRoute sends errors matching Match to one or more webhooks
+type DiscordRoute struct {
+	Name     string     `json:"name"`
+	Match    ErrorMatch `json:"match"`
+	Webhooks []string   `json:"webhooks"`
+	// Continue keeps evaluating later routes after this one matched (fan-out)
+	Continue bool `json:"continue,omitempty"`
+	// Forum marks the webhooks as forum channels: one thread per error group
+	Forum bool `json:"forum,omitempty"`
+}
+
+// DiscordRoutingConfig is the content of DISCORD_ROUTES_FILE
+type DiscordRoutingConfig struct {
+	// Default webhooks receive errors no route matched
+	Default      []string       `json:"default"`
+	DefaultForum bool           `json:"default_forum,omitempty"`
+	Routes       []DiscordRoute `json:"routes"`
+}
+
+// discordTarget is one resolved webhook destination
+type discordTarget struct {
+	URL   string
+	Forum bool
+}
+
+// discordRouter resolves the webhooks an error should be delivered to
+type discordRouter struct {
+	config DiscordRoutingConfig
+}
+
+// loadDiscordRouter reads DISCORD_ROUTES_FILE if set. Webhook URLs may
+// reference environment variables ("${DISCORD_PAYMENTS_WEBHOOK}") so the
+// file does not need to contain secrets. Without a file, or without a
+// default in it, defaultURL is the default route. DISCORD_FORUM_THREADS=true
+// marks the default webhooks as forum channels.
+func loadDiscordRouter(defaultURL string) (*discordRouter, error) {
+	router := &discordRouter{}
+	router.config.DefaultForum = os.Getenv("DISCORD_FORUM_THREADS") == "true"
+	if path := os.Getenv("DISCORD_ROUTES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Discord routes file: %w", err)
+		}
+		if err := json.Unmarshal(data, &router.config); err != nil {
+			return nil, fmt.Errorf("failed to parse Discord routes file %s: %w", path, err)
+		}
+	}
+
+	router.config.Default = expandEnvList(router.config.Default)
+	if len(router.config.Default) == 0 && defaultURL != "" {
+		router.config.Default = []string{defaultURL}
+	}
+	for i := range router.config.Routes {
+		route := &router.config.Routes[i]
+		route.Webhooks = expandEnvList(route.Webhooks)
+		if len(route.Webhooks) == 0 {
+			fmt.Fprintf(os.Stderr, "Discord route %q has no webhooks configured, its errors go to the default webhooks\n", route.Name)
+		}
+	}
+
+	return router, nil
+}
+
+// Resolve returns the unique webhooks err should be sent to, in route order.
+// Errors whose matching routes have no webhooks (e.g. an unset env var) go
+// to the default webhooks like unmatched errors.
+func (r *discordRouter) Resolve(err *errorid.ErrorWithID) []discordTarget {
+	var targets []discordTarget
+
+	for _, route := range r.config.Routes {
+		if !route.Match.Matches(err) {
+			continue
+		}
+		targets = appendTargets(targets, route.Forum, route.Webhooks...)
+		if !route.Continue {
+			break
+		}
+	}
+
+	if len(targets) == 0 {
+		targets = appendTargets(targets, r.config.DefaultForum, r.config.Default...)
+	}
+	return targets
+}
+
+// expandEnvList expands environment references such as ${DISCORD_OPS_WEBHOOK}
+// in configured values (webhook URLs, chat IDs, addresses), trims them and
+// drops empty entries
+func expandEnvList(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(os.ExpandEnv(value)); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// appendTargets appends webhooks not already present in targets
+func appendTargets(targets []discordTarget, forum bool, webhooks ...string) []discordTarget {
+	for _, webhook := range webhooks {
+		duplicate := false
+		for _, target := range targets {
+			if target.URL == webhook {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			targets = append(targets, discordTarget{URL: webhook, Forum: forum})
+		}
+	}
+	return targets
+}
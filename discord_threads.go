@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// discordThreadStore maps error groups to Discord forum thread IDs and
+// persists the mapping so restarts keep posting into the same threads
+type discordThreadStore struct {
+	mu      sync.Mutex
+	path    string
+	threads map[string]string
+}
+
+// loadDiscordThreadStore reads the mapping from path; a missing file starts empty
+func loadDiscordThreadStore(path string) *discordThreadStore {
+	store := &discordThreadStore{
+		path:    path,
+		threads: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to read Discord thread store: %v\n", err)
+		}
+		return store
+	}
+	if err := json.Unmarshal(data, &store.threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse Discord thread store %s: %v\n", path, err)
+	}
+	return store
+}
+
+// Get returns the thread ID for key, or "" if none exists yet
+func (s *discordThreadStore) Get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.threads[key]
+}
+
+// Set records the thread ID for key and persists the mapping
+func (s *discordThreadStore) Set(key, threadID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.threads[key] = threadID
+	s.save()
+}
+
+// Delete forgets the thread for key, e.g. after the thread was deleted in Discord
+func (s *discordThreadStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.threads, key)
+	s.save()
+}
+
+// save writes the mapping atomically; callers must hold s.mu
+func (s *discordThreadStore) save() {
+	if s.path == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(s.threads, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode Discord thread store: %v\n", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".discord-threads-*")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save Discord thread store: %v\n", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		fmt.Fprintf(os.Stderr, "Failed to save Discord thread store: %v\n", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save Discord thread store: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save Discord thread store: %v\n", err)
+	}
+}
+
+// threadKey identifies an error group within one webhook's forum channel.
+// The webhook ID is used instead of the URL so tokens never hit the disk.
+func threadKey(webhookURL, fingerprint string) string {
+	return discordWebhookID(webhookURL) + ":" + fingerprint
+}
+
+// discordWebhookID extracts the ID from .../webhooks/{id}/{token}, or
+// hashes the URL when it does not have that shape
+func discordWebhookID(webhookURL string) string {
+	if u, err := url.Parse(webhookURL); err == nil {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		for i := 0; i+1 < len(parts); i++ {
+			if parts[i] == "webhooks" {
+				return parts[i+1]
+			}
+		}
+	}
+	sum := sha1.Sum([]byte(webhookURL))
+	return hex.EncodeToString(sum[:8])
+}
+
+// withQuery returns rawURL with key=value added to its query string
+func withQuery(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// isUnknownThread reports whether a 4xx response means the thread no longer exists
+func isUnknownThread(status int, body []byte) bool {
+	var payload struct {
+		Code int `json:"code"`
+	}
+	_ = json.Unmarshal(body, &payload)
+	// 10003: Unknown Channel
+	return status == 404 || payload.Code == 10003
+}
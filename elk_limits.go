@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	// defaultELKMaxDocumentBytes stays well below Logstash/Elasticsearch http.max_content_length
+	defaultELKMaxDocumentBytes = 512 * 1024
+	// defaultELKMaxFieldBytes matches the Lucene single-term limit for keyword fields
+	defaultELKMaxFieldBytes = 32766
+	// defaultELKMaxDetailFields keeps well clear of index.mapping.total_fields.limit
+	defaultELKMaxDetailFields = 100
+
+	truncatedMarker = "...[truncated]"
+)
+
+// elkLimits bounds the size and shape of documents sent to ELK
+type elkLimits struct {
+	maxDocumentBytes int
+	maxFieldBytes    int
+	maxDetailFields  int
+}
+
+// loadELKLimits reads ELK_MAX_DOCUMENT_BYTES, ELK_MAX_FIELD_BYTES and
+// ELK_MAX_DETAIL_FIELDS, falling back to defaults
+func loadELKLimits() elkLimits {
+	return elkLimits{
+		maxDocumentBytes: envInt("ELK_MAX_DOCUMENT_BYTES", defaultELKMaxDocumentBytes),
+		maxFieldBytes:    envInt("ELK_MAX_FIELD_BYTES", defaultELKMaxFieldBytes),
+		maxDetailFields:  envInt("ELK_MAX_DETAIL_FIELDS", defaultELKMaxDetailFields),
+	}
+}
+
+// limitDetails keeps at most maxDetailFields details (in key order) and
+// returns the keys that were dropped
+func (l elkLimits) limitDetails(details map[string]interface{}) (map[string]interface{}, []string) {
+	if l.maxDetailFields <= 0 || len(details) <= l.maxDetailFields {
+		return details, nil
+	}
+
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kept := make(map[string]interface{}, l.maxDetailFields)
+	for _, key := range keys[:l.maxDetailFields] {
+		kept[key] = details[key]
+	}
+	return kept, keys[l.maxDetailFields:]
+}
+
+// truncateFields shortens every string value longer than maxFieldBytes,
+// including nested ones, and returns the paths that were truncated
+func (l elkLimits) truncateFields(entry map[string]interface{}) []string {
+	if l.maxFieldBytes <= 0 {
+		return nil
+	}
+
+	var truncated []string
+	var walk func(path string, value interface{}) interface{}
+	walk = func(path string, value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			if len(v) > l.maxFieldBytes {
+				truncated = append(truncated, path)
+				return truncateUTF8(v, l.maxFieldBytes)
+			}
+		case map[string]interface{}:
+			for key, item := range v {
+				v[key] = walk(path+"."+key, item)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = walk(fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		}
+		return value
+	}
+
+	for key, value := range entry {
+		entry[key] = walk(key, value)
+	}
+	sort.Strings(truncated)
+	return truncated
+}
+
+// encode marshals entry, shrinking the stack trace and then the largest
+// detail fields until the document fits maxDocumentBytes
+func (l elkLimits) encode(entry map[string]interface{}, detailKeys []string) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil || l.maxDocumentBytes <= 0 || len(data) <= l.maxDocumentBytes {
+		return data, err
+	}
+
+	// First give up stack trace bytes, which are usually the bulk
+	if stack, ok := entry["stack_trace"].(string); ok {
+		excess := len(data) - l.maxDocumentBytes
+		keep := len(stack) - excess - len(truncatedMarker) - 64
+		if keep > 0 {
+			entry["stack_trace"] = truncateUTF8(stack, keep)
+		} else {
+			delete(entry, "stack_trace")
+		}
+		markTruncated(entry, "stack_trace")
+
+		if data, err = json.Marshal(entry); err != nil || len(data) <= l.maxDocumentBytes {
+			return data, err
+		}
+	}
+
+	// Then drop detail fields, largest first
+	sizes := make(map[string]int, len(detailKeys))
+	for _, key := range detailKeys {
+		encoded, _ := json.Marshal(entry[key])
+		sizes[key] = len(encoded)
+	}
+	keys := append([]string(nil), detailKeys...)
+	sort.Slice(keys, func(i, j int) bool { return sizes[keys[i]] > sizes[keys[j]] })
+
+	for _, key := range keys {
+		delete(entry, key)
+		markTruncated(entry, key)
+		if data, err = json.Marshal(entry); err != nil || len(data) <= l.maxDocumentBytes {
+			return data, err
+		}
+	}
+
+	// Finally clamp the core message fields
+	for _, key := range []string{"error", "context"} {
+		if value, ok := entry[key].(string); ok && len(value) > 1024 {
+			entry[key] = truncateUTF8(value, 1024)
+			markTruncated(entry, key)
+		}
+	}
+	return json.Marshal(entry)
+}
+
+// markTruncated appends field to the document's _truncated marker list
+func markTruncated(entry map[string]interface{}, fields ...string) {
+	if len(fields) == 0 {
+		return
+	}
+	existing, _ := entry["_truncated"].([]string)
+	for _, field := range fields {
+		if !containsString(existing, field) {
+			existing = append(existing, field)
+		}
+	}
+	entry["_truncated"] = existing
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateUTF8 cuts s to at most maxBytes (marker included) without
+// splitting a multi-byte rune
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	cut := maxBytes - len(truncatedMarker)
+	if cut <= 0 {
+		return truncatedMarker[:maxBytes]
+	}
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + truncatedMarker
+}
+
+// envInt reads a positive integer environment variable
+func envInt(name string, defaultValue int) int {
+	if raw := os.Getenv(name); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value >= 0 {
+			return value
+		}
+		fmt.Fprintf(os.Stderr, "Invalid %s=%q, using default %d\n", name, raw, defaultValue)
+	}
+	return defaultValue
+}
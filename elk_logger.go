@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -15,6 +14,7 @@ import (
 type ELKLogger struct {
 	elkURL     string
 	httpClient *http.Client
+	limits     elkLimits
 }
 
 // NewELKLogger creates a new ELK logger instance
@@ -24,6 +24,7 @@ func NewELKLogger(elkURL string) *ELKLogger {
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		limits: loadELKLimits(),
 	}
 }
 
@@ -58,25 +59,56 @@ func (l *ELKLogger) sendStructuredError(id string, err error, context string, de
 		"error_id":    id,
 		"error_type":  "tracked",
 		"context":     context,
-		"error":       err.Error(),
-		"service":     "go-support-id-example",
-		"level":       "error",
+		"error":       errorMessage(err),
+		"level":       classifySeverity(context, details).String(),
 		"environment": os.Getenv("ENVIRONMENT"),
 	}
 
+	// Enrich with service, host, container and build metadata
+	for key, value := range getRuntimeMetadata().Fields() {
+		logEntry[key] = value
+	}
+
 	// Add stack trace if available
 	if stackTrace != "" {
 		logEntry["stack_trace"] = stackTrace
 	}
 
-	// Add all details as separate fields for better filtering
-	if len(details) > 0 {
+	// The request ID is a top-level field outside the droppable details,
+	// so the document can always be joined with the access log
+	if requestID, ok := details["request_id"].(string); ok && requestID != "" {
+		logEntry["request_id"] = requestID
+		rest := make(map[string]interface{}, len(details))
 		for key, value := range details {
+			if key != "request_id" {
+				rest[key] = value
+			}
+		}
+		details = rest
+	}
+
+	// Add all details as separate fields for better filtering.
+	// Values are sanitized first so a single unencodable value
+	// (chan, func, NaN, cyclic struct) cannot drop the whole document.
+	var detailKeys []string
+	if len(details) > 0 {
+		safeDetails, warnings := sanitizeDetails(details)
+		keptDetails, dropped := l.limits.limitDetails(safeDetails)
+		for key, value := range keptDetails {
 			logEntry[key] = value
+			detailKeys = append(detailKeys, key)
+		}
+		if len(warnings) > 0 {
+			logEntry["encoding_warnings"] = warnings
+		}
+		if len(dropped) > 0 {
+			logEntry["_dropped_fields"] = dropped
 		}
 	}
 
-	jsonData, err := json.Marshal(logEntry)
+	// Enforce per-field and whole-document size limits
+	markTruncated(logEntry, l.limits.truncateFields(logEntry)...)
+	jsonData, err := l.limits.encode(logEntry, detailKeys)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to marshal structured error: %v\n", err)
 		return
@@ -108,5 +140,13 @@ func (l *ELKLogger) sendStructuredError(id string, err error, context string, de
 	}
 }
 
+// errorMessage returns err.Error(), tolerating nil errors
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
 // Ensure ELKLogger implements errorid.Logger interface
 var _ errorid.Logger = (*ELKLogger)(nil)
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+const defaultEmailBatchWindow = time.Minute
+
+// EmailRoute sends errors matching Match to the listed recipients
+type EmailRoute struct {
+	Name  string     `json:"name"`
+	Match ErrorMatch `json:"match"`
+	To    []string   `json:"to"`
+	// Continue keeps evaluating later routes after this one matched
+	Continue bool `json:"continue,omitempty"`
+}
+
+// EmailRoutingConfig is the content of EMAIL_ROUTES_FILE
+type EmailRoutingConfig struct {
+	// Default recipients receive errors no route matched
+	Default []string     `json:"default"`
+	Routes  []EmailRoute `json:"routes"`
+}
+
+// smtpConfig holds the SMTP connection settings
+type smtpConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	StartTLS bool
+}
+
+// EmailNotifier emails error alerts over SMTP. Errors arriving within the
+// batch window are collected per recipient list and sent as one email,
+// grouped by fingerprint.
+type EmailNotifier struct {
+	smtp      smtpConfig
+	routes    EmailRoutingConfig
+	templates *emailTemplates
+	window    time.Duration
+	// sendMail delivers a rendered message; email_test.go replaces it with
+	// an in-process stand-in
+	sendMail func(from string, to []string, message []byte) error
+
+	mu      sync.Mutex
+	batches map[string]*emailBatch
+}
+
+// emailBatch collects errors for one recipient list
+type emailBatch struct {
+	to     []string
+	groups []*emailGroup
+	byKey  map[string]*emailGroup
+	timer  *time.Timer
+	// waiters are told the outcome once the batch has been sent
+	waiters []func(error)
+}
+
+// NewEmailNotifier configures email alerts from SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM, SMTP_STARTTLS, EMAIL_TO and
+// EMAIL_ROUTES_FILE. It returns nil when SMTP_HOST is not set.
+func NewEmailNotifier() (*EmailNotifier, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, nil
+	}
+
+	config := smtpConfig{
+		Host:     host,
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		StartTLS: os.Getenv("SMTP_STARTTLS") != "false",
+	}
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	if config.From == "" {
+		config.From = config.Username
+	}
+	if config.From == "" {
+		return nil, fmt.Errorf("SMTP_FROM is required for email notifications")
+	}
+
+	routes, err := loadEmailRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := loadEmailTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	window := defaultEmailBatchWindow
+	if raw := os.Getenv("EMAIL_BATCH_WINDOW"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+			window = d
+		} else {
+			fmt.Fprintf(os.Stderr, "Invalid EMAIL_BATCH_WINDOW=%q, using %s\n", raw, window)
+		}
+	}
+
+	n := &EmailNotifier{
+		smtp:      config,
+		routes:    routes,
+		templates: templates,
+		window:    window,
+		batches:   make(map[string]*emailBatch),
+	}
+	n.sendMail = n.sendSMTP
+	return n, nil
+}
+
+// loadEmailRoutes reads EMAIL_ROUTES_FILE; EMAIL_TO (comma-separated) is
+// the default recipient list when the file has none
+func loadEmailRoutes() (EmailRoutingConfig, error) {
+	var config EmailRoutingConfig
+	if path := os.Getenv("EMAIL_ROUTES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to read email routes file: %w", err)
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, fmt.Errorf("failed to parse email routes file %s: %w", path, err)
+		}
+	}
+
+	if len(config.Default) == 0 {
+		config.Default = expandEnvList(strings.Split(os.Getenv("EMAIL_TO"), ","))
+	}
+	if len(config.Default) == 0 && len(config.Routes) == 0 {
+		return config, fmt.Errorf("EMAIL_TO or EMAIL_ROUTES_FILE is required for email notifications")
+	}
+	return config, nil
+}
+
+// Name implements Notifier
+func (n *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Notify adds err to the batch of every matching recipient list and waits
+// until those batches have been sent
+func (n *EmailNotifier) Notify(err *errorid.ErrorWithID) error {
+	result := make(chan error, 1)
+	n.NotifyDelivery(err, Delivery{}, func(sendErr error) { result <- sendErr })
+	return <-result
+}
+
+// NotifyDelivery implements deliveryNotifier. err is added to the batch of
+// every recipient list it routes to, or only the lists that failed before
+// on a retry, and done is called once all of those batches have been sent,
+// so the outbox does not mark an email delivered while it is still waiting
+// in a batch. Failed lists are reported as targetErrors keyed by
+// recipientsKey. Without a batch window the email is sent right away.
+func (n *EmailNotifier) NotifyDelivery(err *errorid.ErrorWithID, delivery Delivery, done func(error)) {
+	var lists [][]string
+	for _, to := range n.resolve(err) {
+		if delivery.includes(recipientsKey(to)) {
+			lists = append(lists, to)
+		}
+	}
+	if len(lists) == 0 {
+		done(nil)
+		return
+	}
+
+	var mu sync.Mutex
+	pending := len(lists)
+	failed := targetErrors{}
+	report := func(to []string) func(error) {
+		return func(sendErr error) {
+			mu.Lock()
+			if sendErr != nil {
+				failed[recipientsKey(to)] = fmt.Errorf("email to %s: %w", strings.Join(to, ", "), sendErr)
+			}
+			pending--
+			finished := pending == 0
+			mu.Unlock()
+			if finished {
+				done(failed.err())
+			}
+		}
+	}
+
+	for _, to := range lists {
+		if n.window == 0 {
+			batch := &emailBatch{to: to, byKey: make(map[string]*emailGroup)}
+			batch.add(err)
+			report(to)(n.send(batch))
+			continue
+		}
+		n.enqueue(to, err, report(to))
+	}
+}
+
+// resolve returns the recipient lists for err, in route order
+func (n *EmailNotifier) resolve(err *errorid.ErrorWithID) [][]string {
+	var lists [][]string
+	for _, route := range n.routes.Routes {
+		if len(route.To) == 0 || !route.Match.Matches(err) {
+			continue
+		}
+		lists = append(lists, route.To)
+		if !route.Continue {
+			return lists
+		}
+	}
+	if len(lists) == 0 && len(n.routes.Default) > 0 {
+		lists = append(lists, n.routes.Default)
+	}
+	return lists
+}
+
+// enqueue adds err to the pending batch for to, starting its window; done
+// is called with the outcome when the batch is sent
+func (n *EmailNotifier) enqueue(to []string, err *errorid.ErrorWithID, done func(error)) {
+	key := recipientsKey(to)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	batch, ok := n.batches[key]
+	if !ok {
+		batch = &emailBatch{to: to, byKey: make(map[string]*emailGroup)}
+		batch.timer = time.AfterFunc(n.window, func() { n.flush(key) })
+		n.batches[key] = batch
+	}
+	batch.add(err)
+	batch.waiters = append(batch.waiters, done)
+}
+
+// flush sends and removes the batch for key and reports the outcome to
+// everyone waiting on it
+func (n *EmailNotifier) flush(key string) {
+	n.mu.Lock()
+	batch, ok := n.batches[key]
+	delete(n.batches, key)
+	n.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	err := n.send(batch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to send error email to %s: %v\n", strings.Join(batch.to, ", "), err)
+	}
+	for _, done := range batch.waiters {
+		done(err)
+	}
+}
+
+// Close sends every pending batch immediately
+func (n *EmailNotifier) Close(timeout time.Duration) {
+	n.mu.Lock()
+	keys := make([]string, 0, len(n.batches))
+	for key, batch := range n.batches {
+		batch.timer.Stop()
+		keys = append(keys, key)
+	}
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, key := range keys {
+			n.flush(key)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		fmt.Fprintf(os.Stderr, "Pending error emails not sent within %s\n", timeout)
+	}
+}
+
+// recipientsKey identifies a recipient list regardless of order
+func recipientsKey(to []string) string {
+	sorted := append([]string(nil), to...)
+	sort.Strings(sorted)
+	return strings.ToLower(strings.Join(sorted, ","))
+}
+
+// add records err in its fingerprint group
+func (b *emailBatch) add(err *errorid.ErrorWithID) {
+	fingerprint := errorFingerprint(err)
+	now := time.Now()
+
+	if group, ok := b.byKey[fingerprint]; ok {
+		group.Count++
+		group.LastID = err.ID
+		group.LastSeen = now
+		return
+	}
+
+	group := newEmailGroup(err, fingerprint, now)
+	b.byKey[fingerprint] = group
+	b.groups = append(b.groups, group)
+}
+
+// send renders the batch and delivers it
+func (n *EmailNotifier) send(batch *emailBatch) error {
+	message, err := n.templates.Render(n.smtp.From, batch.to, batch.groups)
+	if err != nil {
+		return err
+	}
+	if err := n.sendMail(n.smtp.From, batch.to, message); err != nil {
+		return err
+	}
+	fmt.Printf("Error email sent to %s: %d error(s)\n", strings.Join(batch.to, ", "), batchTotal(batch.groups))
+	return nil
+}
+
+// sendSMTP delivers message over SMTP, upgrading with STARTTLS and
+// authenticating when credentials are configured
+func (n *EmailNotifier) sendSMTP(from string, to []string, message []byte) error {
+	addr := net.JoinHostPort(n.smtp.Host, n.smtp.Port)
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, n.smtp.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if n.smtp.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %s does not support STARTTLS (set SMTP_STARTTLS=false to send unencrypted)", addr)
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: n.smtp.Host}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if n.smtp.Username != "" {
+		auth := smtp.PlainAuth("", n.smtp.Username, n.smtp.Password, n.smtp.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected email: %w", err)
+	}
+
+	return client.Quit()
+}
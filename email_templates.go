@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// emailGroup is one fingerprint group of a batched email
+type emailGroup struct {
+	Fingerprint string
+	ErrorID     string
+	LastID      string
+	Count       int
+	Context     string
+	Message     string
+	Severity    string
+	Details     []emailDetail
+	StackTrace  string
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+// emailDetail is one detail key/value, sorted by key
+type emailDetail struct {
+	Key   string
+	Value string
+}
+
+// emailData is the data passed to the email templates
+type emailData struct {
+	Service     string
+	Version     string
+	Environment string
+	Host        string
+	Total       int
+	Groups      []*emailGroup
+}
+
+// newEmailGroup starts a group from its first error
+func newEmailGroup(err *errorid.ErrorWithID, fingerprint string, seen time.Time) *emailGroup {
+	keys := make([]string, 0, len(err.Details))
+	for key := range err.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	details := make([]emailDetail, 0, len(keys))
+	for _, key := range keys {
+		details = append(details, emailDetail{Key: key, Value: fmt.Sprint(err.Details[key])})
+	}
+
+	return &emailGroup{
+		Fingerprint: fingerprint,
+		ErrorID:     err.ID,
+		LastID:      err.ID,
+		Count:       1,
+		Context:     err.Context,
+		Message:     errorMessage(err.Original),
+		Severity:    errorSeverity(err).String(),
+		Details:     details,
+		StackTrace:  err.StackTrace,
+		FirstSeen:   seen,
+		LastSeen:    seen,
+	}
+}
+
+// batchTotal counts the errors in all groups
+func batchTotal(groups []*emailGroup) int {
+	total := 0
+	for _, group := range groups {
+		total += group.Count
+	}
+	return total
+}
+
+const defaultEmailTextTemplate = `{{.Total}} error(s) in {{len .Groups}} group(s)
+Service: {{.Service}}{{with .Version}} {{.}}{{end}}
+Environment: {{.Environment}}
+Host: {{.Host}}
+{{range .Groups}}
+========================================
+Error ID: {{.ErrorID}}
+Severity: {{.Severity}}
+Context: {{.Context}}
+Error: {{.Message}}
+{{- if gt .Count 1}}
+Occurrences: {{.Count}} (last {{.LastID}} at {{.LastSeen.Format "15:04:05 MST"}})
+{{- end}}
+{{- if .Details}}
+
+Details:
+{{- range .Details}}
+  {{.Key}}: {{.Value}}
+{{- end}}
+{{- end}}
+{{- if .StackTrace}}
+
+Stack trace:
+{{.StackTrace}}
+{{- end}}
+{{end}}`
+
+const defaultEmailHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, Segoe UI, Helvetica, Arial, sans-serif; color: #1f2328;">
+<h2 style="margin-bottom: 4px;">{{.Total}} error(s) in {{len .Groups}} group(s)</h2>
+<p style="color: #59636e; margin-top: 0;">{{.Service}}{{with .Version}} {{.}}{{end}} &middot; {{.Environment}} &middot; {{.Host}}</p>
+{{range .Groups}}
+<div style="border-left: 4px solid {{if eq .Severity "critical"}}#992d22{{else if eq .Severity "warning"}}#f1c40f{{else if eq .Severity "info"}}#3498db{{else}}#e74c3c{{end}}; padding: 8px 16px; margin: 16px 0; background: #f6f8fa;">
+  <h3 style="margin: 0 0 8px 0;">{{.ErrorID}}</h3>
+  <table style="border-collapse: collapse;">
+    <tr><td style="padding: 2px 12px 2px 0;"><b>Severity</b></td><td>{{.Severity}}</td></tr>
+    <tr><td style="padding: 2px 12px 2px 0;"><b>Context</b></td><td>{{.Context}}</td></tr>
+    <tr><td style="padding: 2px 12px 2px 0;"><b>Error</b></td><td>{{.Message}}</td></tr>
+    {{- if gt .Count 1}}
+    <tr><td style="padding: 2px 12px 2px 0;"><b>Occurrences</b></td><td>{{.Count}} (last {{.LastID}} at {{.LastSeen.Format "15:04:05 MST"}})</td></tr>
+    {{- end}}
+  </table>
+  {{- if .Details}}
+  <h4 style="margin: 12px 0 4px 0;">Details</h4>
+  <table style="border-collapse: collapse;">
+    {{- range .Details}}
+    <tr><td style="padding: 2px 12px 2px 0;"><code>{{.Key}}</code></td><td>{{.Value}}</td></tr>
+    {{- end}}
+  </table>
+  {{- end}}
+  {{- if .StackTrace}}
+  <details>
+    <summary>Stack trace</summary>
+    <pre style="font-size: 12px; white-space: pre-wrap;">{{.StackTrace}}</pre>
+  </details>
+  {{- end}}
+</div>
+{{end}}
+</body>
+</html>
+`
+
+// emailTemplates renders the text and HTML bodies of an error email
+type emailTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// loadEmailTemplates parses the built-in templates, or the files named by
+// EMAIL_TEXT_TEMPLATE and EMAIL_HTML_TEMPLATE
+func loadEmailTemplates() (*emailTemplates, error) {
+	textSource, err := templateSource("EMAIL_TEXT_TEMPLATE", defaultEmailTextTemplate)
+	if err != nil {
+		return nil, err
+	}
+	htmlSource, err := templateSource("EMAIL_HTML_TEMPLATE", defaultEmailHTMLTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := texttemplate.New("text").Parse(textSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email text template: %w", err)
+	}
+	html, err := htmltemplate.New("html").Parse(htmlSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email HTML template: %w", err)
+	}
+	return &emailTemplates{text: text, html: html}, nil
+}
+
+// templateSource reads the template file named by the environment
+// variable, or returns fallback
+func templateSource(name, fallback string) (string, error) {
+	path := os.Getenv(name)
+	if path == "" {
+		return fallback, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
+// Render builds a complete multipart/alternative email for groups
+func (t *emailTemplates) Render(from string, to []string, groups []*emailGroup) ([]byte, error) {
+	meta := getRuntimeMetadata()
+	data := emailData{
+		Service:     meta.Service,
+		Version:     meta.Version,
+		Environment: getEnvironment(),
+		Host:        meta.Location(),
+		Total:       batchTotal(groups),
+		Groups:      groups,
+	}
+
+	var textBody, htmlBody bytes.Buffer
+	if err := t.text.Execute(&textBody, data); err != nil {
+		return nil, fmt.Errorf("failed to render email text template: %w", err)
+	}
+	if err := t.html.Execute(&htmlBody, data); err != nil {
+		return nil, fmt.Errorf("failed to render email HTML template: %w", err)
+	}
+
+	var message bytes.Buffer
+	body := multipart.NewWriter(&message)
+
+	headers := []struct{ name, value string }{
+		{"From", from},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", emailSubject(data))},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), groups[0].ErrorID, messageIDHost(meta.Hostname))},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + body.Boundary()},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&message, "%s: %s\r\n", header.name, header.value)
+	}
+	message.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", textBody.Bytes()},
+		{"text/html; charset=utf-8", htmlBody.Bytes()},
+	} {
+		writer, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
+
+// messageIDHost returns the domain part for Message-ID headers
+func messageIDHost(hostname string) string {
+	if hostname == "" {
+		return "localhost"
+	}
+	return hostname
+}
+
+// emailSubject summarizes the batch in one line
+func emailSubject(data emailData) string {
+	first := data.Groups[0]
+	if data.Total == 1 {
+		return fmt.Sprintf("[%s] Error %s: %s", data.Environment, first.ErrorID, truncateString(first.Context, 100))
+	}
+	return fmt.Sprintf("[%s] %d errors in %d group(s): %s", data.Environment, data.Total, len(data.Groups), truncateString(first.Context, 100))
+}
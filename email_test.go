@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// sentEmail is one message handed to the sendMail stand-in
+type sentEmail struct {
+	to      []string
+	message string
+}
+
+// fakeMailer replaces EmailNotifier.sendMail, recording messages and
+// failing for the recipients in failing
+type fakeMailer struct {
+	mu      sync.Mutex
+	sent    []sentEmail
+	failing map[string]bool
+}
+
+func (f *fakeMailer) sendMail(from string, to []string, message []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failing[recipientsKey(to)] {
+		return errors.New("550 mailbox unavailable")
+	}
+	f.sent = append(f.sent, sentEmail{to: to, message: string(message)})
+	return nil
+}
+
+func (f *fakeMailer) emails() []sentEmail {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]sentEmail(nil), f.sent...)
+}
+
+// newTestEmailNotifier configures email from the environment with a
+// sendMail stand-in, so nothing is sent over SMTP
+func newTestEmailNotifier(t *testing.T, window string) (*EmailNotifier, *fakeMailer) {
+	t.Helper()
+	useFixedRuntimeMetadata(t)
+	t.Setenv("SMTP_HOST", "smtp.test")
+	t.Setenv("SMTP_FROM", "alerts@example.com")
+	t.Setenv("EMAIL_TO", "oncall@example.com")
+	t.Setenv("EMAIL_BATCH_WINDOW", window)
+
+	notifier, err := NewEmailNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailer := &fakeMailer{}
+	notifier.sendMail = mailer.sendMail
+	t.Cleanup(func() { notifier.Close(time.Second) })
+	return notifier, mailer
+}
+
+func testEmailError(id, context string) *errorid.ErrorWithID {
+	return &errorid.ErrorWithID{ID: id, Original: errors.New("connection refused"), Context: context}
+}
+
+func TestEmailBatchesErrorsUntilTheWindowCloses(t *testing.T) {
+	notifier, mailer := newTestEmailNotifier(t, "200ms")
+
+	results := make(chan error, 3)
+	done := func(err error) { results <- err }
+	notifier.NotifyDelivery(testEmailError("ERR-20251023-000001", "failed to charge card"), Delivery{}, done)
+	notifier.NotifyDelivery(testEmailError("ERR-20251023-000002", "failed to charge card"), Delivery{}, done)
+	notifier.NotifyDelivery(testEmailError("ERR-20251023-000003", "failed to load profile"), Delivery{}, done)
+
+	// Nothing is reported delivered while the batch is still waiting
+	select {
+	case err := <-results:
+		t.Fatalf("delivery reported before the batch was sent: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := waitResult(t, results); err != nil {
+			t.Errorf("delivery %d: %v", i, err)
+		}
+	}
+
+	emails := mailer.emails()
+	if len(emails) != 1 {
+		t.Fatalf("sent %d emails, want one batch", len(emails))
+	}
+	if !reflect.DeepEqual(emails[0].to, []string{"oncall@example.com"}) {
+		t.Errorf("email sent to %v", emails[0].to)
+	}
+	for _, want := range []string{"failed to charge card", "failed to load profile", "ERR-20251023-000001"} {
+		if !strings.Contains(emails[0].message, want) {
+			t.Errorf("email does not mention %q", want)
+		}
+	}
+}
+
+func TestEmailReportsFailedBatchesPerRecipientList(t *testing.T) {
+	notifier, mailer := newTestEmailNotifier(t, "50ms")
+	mailer.failing = map[string]bool{"oncall@example.com": true}
+
+	results := make(chan error, 1)
+	notifier.NotifyDelivery(testEmailError("ERR-20251023-000001", "failed to charge card"), Delivery{}, func(err error) { results <- err })
+
+	err := waitResult(t, results)
+	var failed targetErrors
+	if !errors.As(err, &failed) {
+		t.Fatalf("got %v, want targetErrors", err)
+	}
+	if targets := failed.Targets(); !reflect.DeepEqual(targets, []string{"oncall@example.com"}) {
+		t.Errorf("failed targets = %v", targets)
+	}
+	if !strings.Contains(err.Error(), "550") {
+		t.Errorf("error %q does not carry the SMTP reply", err)
+	}
+}
+
+func TestEmailRetrySendsOnlyToFailedLists(t *testing.T) {
+	notifier, mailer := newTestEmailNotifier(t, "0s")
+	notifier.routes = EmailRoutingConfig{
+		Routes: []EmailRoute{
+			{Name: "payments", To: []string{"payments@example.com"}, Continue: true},
+			{Name: "oncall", To: []string{"oncall@example.com"}},
+		},
+	}
+
+	err := notifier.Notify(testEmailError("ERR-20251023-000001", "failed to charge card"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(mailer.emails()); got != 2 {
+		t.Fatalf("sent %d emails, want one per route", got)
+	}
+
+	results := make(chan error, 1)
+	delivery := Delivery{Replay: true, Targets: []string{"oncall@example.com"}}
+	notifier.NotifyDelivery(testEmailError("ERR-20251023-000001", "failed to charge card"), delivery, func(err error) { results <- err })
+	if err := waitResult(t, results); err != nil {
+		t.Fatal(err)
+	}
+
+	emails := mailer.emails()
+	if len(emails) != 3 || !reflect.DeepEqual(emails[2].to, []string{"oncall@example.com"}) {
+		t.Errorf("retry sent %d emails, last to %v; want one to oncall@example.com", len(emails)-2, emails[len(emails)-1].to)
+	}
+}
+
+func TestEmailCloseSendsPendingBatches(t *testing.T) {
+	notifier, mailer := newTestEmailNotifier(t, "1h")
+
+	results := make(chan error, 1)
+	notifier.NotifyDelivery(testEmailError("ERR-20251023-000001", "failed to charge card"), Delivery{}, func(err error) { results <- err })
+	notifier.Close(time.Second)
+
+	if err := waitResult(t, results); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(mailer.emails()); got != 1 {
+		t.Errorf("sent %d emails on Close, want 1", got)
+	}
+}
+
+// fakeSMTPServer speaks just enough SMTP for sendSMTP, recording the
+// commands and message it receives and rejecting the recipients in reject
+type fakeSMTPServer struct {
+	listener net.Listener
+	reject   map[string]bool
+
+	mu       sync.Mutex
+	commands []string
+	messages []string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTPServer{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (s *fakeSMTPServer) port() string {
+	return strconv.Itoa(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(conn)
+	}
+}
+
+func (s *fakeSMTPServer) session(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 smtp.test ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+
+		verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0])
+		switch {
+		case verb == "EHLO":
+			reply("250-smtp.test")
+			reply("250 AUTH PLAIN")
+		case verb == "AUTH":
+			reply("235 2.7.0 Authentication successful")
+		case verb == "MAIL":
+			reply("250 2.1.0 OK")
+		case verb == "RCPT":
+			recipient := strings.Trim(strings.TrimPrefix(command, "RCPT TO:"), "<>")
+			if s.reject[recipient] {
+				reply("550 5.1.1 mailbox unavailable")
+			} else {
+				reply("250 2.1.5 OK")
+			}
+		case verb == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var message strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				message.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, message.String())
+			s.mu.Unlock()
+			reply("250 2.0.0 queued")
+		case verb == "QUIT":
+			reply("221 2.0.0 bye")
+			return
+		default:
+			reply("502 5.5.2 command not recognized")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) received() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...), append([]string(nil), s.messages...)
+}
+
+// newSMTPTestNotifier configures email to send straight to server
+func newSMTPTestNotifier(t *testing.T, server *fakeSMTPServer, startTLS string) *EmailNotifier {
+	t.Helper()
+	useFixedRuntimeMetadata(t)
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", server.port())
+	t.Setenv("SMTP_USERNAME", "alerts")
+	t.Setenv("SMTP_PASSWORD", "secret")
+	t.Setenv("SMTP_FROM", "alerts@example.com")
+	t.Setenv("SMTP_STARTTLS", startTLS)
+	t.Setenv("EMAIL_TO", "oncall@example.com,payments@example.com")
+	t.Setenv("EMAIL_BATCH_WINDOW", "0s")
+
+	notifier, err := NewEmailNotifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { notifier.Close(time.Second) })
+	return notifier
+}
+
+func TestSendSMTPDeliversMessage(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	notifier := newSMTPTestNotifier(t, server, "false")
+
+	if err := notifier.Notify(testEmailError("ERR-20251023-000001", "failed to charge card")); err != nil {
+		t.Fatal(err)
+	}
+
+	commands, messages := server.received()
+	want := []string{
+		"MAIL FROM:<alerts@example.com>",
+		"RCPT TO:<oncall@example.com>",
+		"RCPT TO:<payments@example.com>",
+		"DATA",
+		"QUIT",
+	}
+	var got []string
+	for _, command := range commands {
+		if !strings.HasPrefix(command, "EHLO") && !strings.HasPrefix(command, "AUTH") {
+			got = append(got, command)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SMTP commands = %q, want %q", got, want)
+	}
+	if len(commands) < 2 || !strings.HasPrefix(commands[1], "AUTH PLAIN ") {
+		t.Errorf("SMTP session did not authenticate: %q", commands)
+	}
+
+	if len(messages) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(messages))
+	}
+	for _, want := range []string{"From: alerts@example.com", "ERR-20251023-000001", "failed to charge card"} {
+		if !strings.Contains(messages[0], want) {
+			t.Errorf("message does not contain %q:\n%s", want, messages[0])
+		}
+	}
+}
+
+func TestSendSMTPReportsRejectedRecipient(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	server.reject = map[string]bool{"payments@example.com": true}
+	notifier := newSMTPTestNotifier(t, server, "false")
+
+	err := notifier.Notify(testEmailError("ERR-20251023-000001", "failed to charge card"))
+	if err == nil || !strings.Contains(err.Error(), "RCPT TO payments@example.com") || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("got %v, want the rejected recipient reported", err)
+	}
+	if _, messages := server.received(); len(messages) != 0 {
+		t.Errorf("server received %d messages after a rejected RCPT", len(messages))
+	}
+}
+
+func TestSendSMTPRequiresStartTLS(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	notifier := newSMTPTestNotifier(t, server, "true")
+
+	err := notifier.Notify(testEmailError("ERR-20251023-000001", "failed to charge card"))
+	if err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+		t.Fatalf("got %v, want STARTTLS required", err)
+	}
+	if _, messages := server.received(); len(messages) != 0 {
+		t.Errorf("server received %d messages without STARTTLS", len(messages))
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+const (
+	// errorStatsRetention covers a daily digest plus the previous day for trends
+	errorStatsRetention = 49 * time.Hour
+	// maxErrorStatsRecords bounds memory during error storms
+	maxErrorStatsRecords = 200000
+)
+
+// errorRecord is one tracked error occurrence
+type errorRecord struct {
+	Time        time.Time
+	Fingerprint string
+	Context     string
+	Message     string
+	Handler     string
+	Severity    Severity
+}
+
+// ErrorStats keeps recent tracked errors in memory for digests
+type ErrorStats struct {
+	mu      sync.Mutex
+	records []errorRecord
+	seen    map[string]*groupSeen
+}
+
+// groupSeen is when an error group was first and last recorded. Groups are
+// forgotten once none of their records are retained, so a group that
+// returns after that counts as new again.
+type groupSeen struct {
+	first time.Time
+	last  time.Time
+}
+
+// NewErrorStats creates an empty error statistics store
+func NewErrorStats() *ErrorStats {
+	return &ErrorStats{seen: make(map[string]*groupSeen)}
+}
+
+// Record stores an occurrence of err
+func (s *ErrorStats) Record(err *errorid.ErrorWithID) {
+	handler := detailString(err.Details, "http_route")
+	if handler == "" {
+		handler = "(no route)"
+	}
+
+	record := errorRecord{
+		Time:        time.Now(),
+		Fingerprint: errorFingerprint(err),
+		Context:     err.Context,
+		Message:     errorMessage(err.Original),
+		Handler:     handler,
+		Severity:    errorSeverity(err),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seen, ok := s.seen[record.Fingerprint]; ok {
+		seen.last = record.Time
+	} else {
+		s.seen[record.Fingerprint] = &groupSeen{first: record.Time, last: record.Time}
+	}
+	s.records = append(s.records, record)
+	s.prune(record.Time)
+}
+
+// prune drops records older than the retention window, and the groups
+// left without records; callers hold s.mu
+func (s *ErrorStats) prune(now time.Time) {
+	cutoff := now.Add(-errorStatsRetention)
+	i := sort.Search(len(s.records), func(i int) bool { return s.records[i].Time.After(cutoff) })
+	if len(s.records)-i > maxErrorStatsRecords {
+		i = len(s.records) - maxErrorStatsRecords
+	}
+	if i == 0 {
+		return
+	}
+	// Reslicing keeps this O(1) per Record; append copies only the retained
+	// records once the backing array fills up, releasing the dropped ones
+	s.records = s.records[i:]
+
+	oldest := now
+	if len(s.records) > 0 {
+		oldest = s.records[0].Time
+	}
+	for fingerprint, seen := range s.seen {
+		if seen.last.Before(oldest) {
+			delete(s.seen, fingerprint)
+		}
+	}
+}
+
+// errorGroupCount is an error group with its occurrence count in a period
+type errorGroupCount struct {
+	Fingerprint string
+	Context     string
+	Message     string
+	Count       int
+	Severity    Severity
+}
+
+// periodStats summarizes the errors of one period
+type periodStats struct {
+	Start         time.Time
+	End           time.Time
+	Total         int
+	PreviousTotal int
+	Groups        []errorGroupCount // sorted by count, descending
+	NewGroups     []errorGroupCount // first seen during the period
+	ByHandler     map[string]int
+}
+
+// Summarize computes statistics for [start, end) and the total of the
+// equally long period before it
+func (s *ErrorStats) Summarize(start, end time.Time) periodStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := periodStats{
+		Start:     start,
+		End:       end,
+		ByHandler: make(map[string]int),
+	}
+	previousStart := start.Add(-end.Sub(start))
+	groups := make(map[string]*errorGroupCount)
+
+	for _, record := range s.records {
+		if !record.Time.Before(previousStart) && record.Time.Before(start) {
+			stats.PreviousTotal++
+			continue
+		}
+		if record.Time.Before(start) || !record.Time.Before(end) {
+			continue
+		}
+
+		stats.Total++
+		stats.ByHandler[record.Handler]++
+
+		group, ok := groups[record.Fingerprint]
+		if !ok {
+			group = &errorGroupCount{
+				Fingerprint: record.Fingerprint,
+				Context:     record.Context,
+				Message:     record.Message,
+			}
+			groups[record.Fingerprint] = group
+		}
+		group.Count++
+		if record.Severity > group.Severity {
+			group.Severity = record.Severity
+		}
+	}
+
+	for fingerprint, group := range groups {
+		stats.Groups = append(stats.Groups, *group)
+		if seen := s.seen[fingerprint]; seen != nil && !seen.first.Before(start) {
+			stats.NewGroups = append(stats.NewGroups, *group)
+		}
+	}
+	sortGroups(stats.Groups)
+	sortGroups(stats.NewGroups)
+
+	return stats
+}
+
+// sortGroups orders groups by count, then fingerprint for stable output
+func sortGroups(groups []errorGroupCount) {
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Fingerprint < groups[j].Fingerprint
+	})
+}
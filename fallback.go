@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+const defaultHealthAlertAfter = 5 * time.Minute
+
+// FallbackRoute hands errors matching Match to Fallbacks, in order, when
+// Notifier fails to deliver them
+type FallbackRoute struct {
+	Name      string     `json:"name"`
+	Notifier  string     `json:"notifier"`
+	Match     ErrorMatch `json:"match"`
+	Fallbacks []string   `json:"fallbacks"`
+}
+
+// FallbackConfig is the content of NOTIFIER_FALLBACKS_FILE
+type FallbackConfig struct {
+	Routes []FallbackRoute `json:"routes"`
+}
+
+// fallbackChains resolves the fallback chain for a failed notification
+type fallbackChains struct {
+	routes   []FallbackRoute
+	defaults map[string][]string
+}
+
+// loadFallbackChains reads NOTIFIER_FALLBACKS_FILE and, for each notifier,
+// <NAME>_FALLBACK (comma-separated notifier names) as the chain used when
+// no route in the file matches
+func loadFallbackChains(names []string) (*fallbackChains, error) {
+	chains := &fallbackChains{defaults: make(map[string][]string)}
+	for _, name := range names {
+		if chain := splitNames(os.Getenv(strings.ToUpper(name) + "_FALLBACK")); len(chain) > 0 {
+			chains.defaults[name] = chain
+		}
+	}
+
+	path := os.Getenv("NOTIFIER_FALLBACKS_FILE")
+	if path == "" {
+		return chains, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return chains, fmt.Errorf("failed to read notifier fallbacks file: %w", err)
+	}
+	var config FallbackConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return chains, fmt.Errorf("failed to parse notifier fallbacks file %s: %w", path, err)
+	}
+	for _, route := range config.Routes {
+		route.Notifier = strings.ToLower(strings.TrimSpace(route.Notifier))
+		if route.Notifier == "" || len(route.Fallbacks) == 0 {
+			fmt.Fprintf(os.Stderr, "Fallback route %q needs a notifier and fallbacks, skipping\n", route.Name)
+			continue
+		}
+		route.Fallbacks = splitNames(strings.Join(route.Fallbacks, ","))
+		chains.routes = append(chains.routes, route)
+	}
+	return chains, nil
+}
+
+// Chain returns the fallbacks to try when notifier failed to deliver err:
+// the first matching route for notifier, else <NAME>_FALLBACK
+func (c *fallbackChains) Chain(notifier string, err *errorid.ErrorWithID) []string {
+	for _, route := range c.routes {
+		if route.Notifier == notifier && route.Match.Matches(err) {
+			return route.Fallbacks
+		}
+	}
+	return c.defaults[notifier]
+}
+
+// Names returns every notifier referenced as a fallback
+func (c *fallbackChains) Names() []string {
+	var names []string
+	for _, chain := range c.defaults {
+		names = appendUniqueStrings(names, chain...)
+	}
+	for _, route := range c.routes {
+		names = appendUniqueStrings(names, route.Fallbacks...)
+	}
+	return names
+}
+
+// withFallbackDetails copies err with details saying which notifier failed,
+// so the fallback notification explains why it was sent there
+func withFallbackDetails(err *errorid.ErrorWithID, primary string, cause error) *errorid.ErrorWithID {
+	details := make(map[string]interface{}, len(err.Details)+2)
+	for key, value := range err.Details {
+		details[key] = value
+	}
+	details["fallback_for"] = primary
+	details["fallback_reason"] = cause.Error()
+
+	copied := *err
+	copied.Details = details
+	return &copied
+}
+
+// notifierHealth tracks consecutive delivery failures per notifier and
+// raises a meta-alert once a notifier has been failing for the threshold,
+// and a recovery notice when it delivers again
+type notifierHealth struct {
+	threshold time.Duration
+	alertTo   []string
+	now       func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*notifierHealthState
+}
+
+// notifierHealthState is the current outage of one notifier
+type notifierHealthState struct {
+	failingSince time.Time
+	failures     int
+	lastError    string
+	alerted      bool
+}
+
+// loadNotifierHealth configures meta-alerts from NOTIFIER_HEALTH_ALERT
+// (comma-separated notifiers that receive them) and
+// NOTIFIER_HEALTH_ALERT_AFTER. It returns nil when NOTIFIER_HEALTH_ALERT is
+// not set.
+func loadNotifierHealth() *notifierHealth {
+	alertTo := splitNames(os.Getenv("NOTIFIER_HEALTH_ALERT"))
+	if len(alertTo) == 0 {
+		return nil
+	}
+
+	threshold := defaultHealthAlertAfter
+	if raw := os.Getenv("NOTIFIER_HEALTH_ALERT_AFTER"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+			threshold = d
+		} else {
+			fmt.Fprintf(os.Stderr, "Invalid NOTIFIER_HEALTH_ALERT_AFTER=%q, using %s\n", raw, threshold)
+		}
+	}
+
+	return &notifierHealth{
+		threshold: threshold,
+		alertTo:   alertTo,
+		now:       time.Now,
+		states:    make(map[string]*notifierHealthState),
+	}
+}
+
+// Failure records a failed delivery. It returns the meta-alert to send when
+// the notifier has now been failing for at least the threshold.
+func (h *notifierHealth) Failure(name string, cause error) *errorid.ErrorWithID {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	state, ok := h.states[name]
+	if !ok {
+		state = &notifierHealthState{failingSince: now}
+		h.states[name] = state
+	}
+	state.failures++
+	state.lastError = cause.Error()
+
+	failingFor := now.Sub(state.failingSince)
+	if state.alerted || failingFor < h.threshold {
+		return nil
+	}
+	state.alerted = true
+
+	return &errorid.ErrorWithID{
+		ID:       healthAlertID("DOWN", name, now),
+		Original: errors.New(state.lastError),
+		Context:  fmt.Sprintf("%s notifier failing for %s", name, failingFor.Round(time.Second)),
+		Details: map[string]interface{}{
+			"category":      "notifier_health",
+			"severity":      "critical",
+			"notifier":      name,
+			"failing_since": state.failingSince.UTC().Format(time.RFC3339),
+			"failures":      state.failures,
+		},
+	}
+}
+
+// Success records a successful delivery. It returns a recovery notice when
+// a meta-alert was sent for the outage that just ended.
+func (h *notifierHealth) Success(name string) *errorid.ErrorWithID {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state, ok := h.states[name]
+	if !ok {
+		return nil
+	}
+	delete(h.states, name)
+	if !state.alerted {
+		return nil
+	}
+
+	now := h.now()
+	return &errorid.ErrorWithID{
+		ID:       healthAlertID("UP", name, now),
+		Original: fmt.Errorf("%s delivered again after %d failures", name, state.failures),
+		Context:  fmt.Sprintf("%s notifier recovered after %s", name, now.Sub(state.failingSince).Round(time.Second)),
+		Details: map[string]interface{}{
+			"category":      "notifier_health",
+			"severity":      "info",
+			"notifier":      name,
+			"failing_since": state.failingSince.UTC().Format(time.RFC3339),
+			"failures":      state.failures,
+			"last_error":    state.lastError,
+		},
+	}
+}
+
+// healthAlertID builds IDs such as NOTIFIER-DOWN-DISCORD-20251023-101500
+func healthAlertID(kind, name string, at time.Time) string {
+	return fmt.Sprintf("NOTIFIER-%s-%s-%s", kind, strings.ToUpper(name), at.UTC().Format("20060102-150405"))
+}
+
+// splitNames splits a comma-separated list of notifier names
+func splitNames(raw string) []string {
+	var names []string
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
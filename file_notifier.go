@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// FileNotifier appends errors as JSON lines to a local file. It has no
+// network dependency, which makes it the last resort of a fallback chain.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+// fileNotification is one line of the notification file
+type fileNotification struct {
+	Timestamp   string                 `json:"timestamp"`
+	ErrorID     string                 `json:"error_id"`
+	Context     string                 `json:"context"`
+	Error       string                 `json:"error"`
+	Severity    string                 `json:"severity"`
+	Fingerprint string                 `json:"fingerprint"`
+	Environment string                 `json:"environment"`
+	Host        string                 `json:"host"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	StackTrace  string                 `json:"stack_trace,omitempty"`
+}
+
+// NewFileNotifier configures the file notifier from FILE_NOTIFIER_PATH.
+// It returns nil when FILE_NOTIFIER_PATH is not set.
+func NewFileNotifier() *FileNotifier {
+	path := os.Getenv("FILE_NOTIFIER_PATH")
+	if path == "" {
+		return nil
+	}
+	return &FileNotifier{path: path}
+}
+
+// Name implements Notifier
+func (f *FileNotifier) Name() string {
+	return "file"
+}
+
+// Notify appends err and syncs the file
+func (f *FileNotifier) Notify(err *errorid.ErrorWithID) error {
+	details, _ := sanitizeDetails(err.Details)
+	line, marshalErr := json.Marshal(fileNotification{
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		ErrorID:     err.ID,
+		Context:     err.Context,
+		Error:       errorMessage(err.Original),
+		Severity:    errorSeverity(err).String(),
+		Fingerprint: errorFingerprint(err),
+		Environment: getEnvironment(),
+		Host:        getRuntimeMetadata().Location(),
+		Details:     details,
+		StackTrace:  err.StackTrace,
+	})
+	if marshalErr != nil {
+		return fmt.Errorf("failed to marshal file notification: %w", marshalErr)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, openErr := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if openErr != nil {
+		return fmt.Errorf("failed to open notification file: %w", openErr)
+	}
+	defer file.Close()
+
+	if _, writeErr := file.Write(append(line, '\n')); writeErr != nil {
+		return fmt.Errorf("failed to write notification file: %w", writeErr)
+	}
+	if syncErr := file.Sync(); syncErr != nil {
+		return fmt.Errorf("failed to sync notification file: %w", syncErr)
+	}
+	fmt.Printf("Error notification written to %s: %s\n", f.path, err.ID)
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+var (
+	// Volatile parts of error messages that should not split groups
+	errorIDPattern = regexp.MustCompile(`ERR-[0-9A-Za-z-]+`)
+	hexPattern     = regexp.MustCompile(`0x[0-9a-fA-F]+|\b[0-9a-fA-F]{16,}\b`)
+	numberPattern  = regexp.MustCompile(`\d+`)
+)
+
+// errorFingerprint groups errors sharing the same context and normalized
+// message, so repeated occurrences of one failure map to one key
+func errorFingerprint(err *errorid.ErrorWithID) string {
+	message := errorMessage(err.Original)
+	normalized := strings.ToLower(err.Context + "|" + normalizeErrorMessage(message))
+
+	sum := sha1.Sum([]byte(normalized))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// normalizeErrorMessage strips error IDs, addresses and numbers from a message
+func normalizeErrorMessage(message string) string {
+	message = errorIDPattern.ReplaceAllString(message, "ERR")
+	message = hexPattern.ReplaceAllString(message, "0x")
+	message = numberPattern.ReplaceAllString(message, "#")
+	return strings.TrimSpace(message)
+}
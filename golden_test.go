@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/*.golden files")
+
+// assertGolden compares v, encoded as indented JSON, with
+// testdata/<name>.golden. Run go test -update to rewrite the files.
+func assertGolden(t *testing.T, name string, v interface{}) {
+	t.Helper()
+
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to encode %s: %v", name, err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match the generated payload:\n%s", path, got)
+	}
+}
+
+// useFixedRuntimeMetadata pins host and build metadata so payloads are
+// the same on every machine
+func useFixedRuntimeMetadata(t *testing.T) {
+	t.Helper()
+	original := getRuntimeMetadata
+	getRuntimeMetadata = func() RuntimeMetadata {
+		return RuntimeMetadata{
+			Service:     "go-support-id-example",
+			Version:     "1.4.0",
+			Hostname:    "api-1",
+			PID:         42,
+			GoVersion:   "go1.24.4",
+			VCSRevision: "0123456789abcdef0123",
+		}
+	}
+	t.Cleanup(func() { getRuntimeMetadata = original })
+}
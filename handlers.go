@@ -29,11 +29,26 @@ func NewHandlers() *Handlers {
 	}
 }
 
+// withRequestDetails tags details with the error category, the response
+// status errorid.WriteError sends (always 500), the request method/route and
+// the request ID, so notifications can be routed and filtered on them and
+// matched to the request that caused them
+func withRequestDetails(c *gin.Context, category string, details map[string]interface{}) map[string]interface{} {
+	details["category"] = category
+	details["http_status"] = http.StatusInternalServerError
+	details["http_method"] = c.Request.Method
+	details["http_route"] = c.FullPath()
+	if id := RequestIDFromContext(c.Request.Context()); id != "" {
+		details["request_id"] = id
+	}
+	return details
+}
+
 // HealthCheck handles health check endpoint
 func (h *Handlers) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status": "healthy",
-		"service": "go-support-id-example",
+		"service": getServiceName(),
 	})
 }
 
@@ -48,12 +63,12 @@ func (h *Handlers) HandleDatabaseError(c *gin.Context) {
 		wrappedErr := errorid.WrapWithDetails(
 			err,
 			"failed to connect to PostgreSQL",
-			map[string]interface{}{
+			withRequestDetails(c, "database", map[string]interface{}{
 				"database": "postgres",
 				"host":     "db.example.com",
 				"port":     5432,
 				"timeout":  "30s",
-			},
+			}),
 		)
 
 		// Use errorid.WriteError helper from library
@@ -76,12 +91,12 @@ func (h *Handlers) HandleValidationError(c *gin.Context) {
 		wrappedErr := errorid.WrapWithDetails(
 			err,
 			"user registration validation failed",
-			map[string]interface{}{
+			withRequestDetails(c, "validation", map[string]interface{}{
 				"field":          "email",
 				"provided_value": email,
 				"expected":       "valid email format",
 				"username":       username,
-			},
+			}),
 		)
 
 		// Use errorid.WriteError helper from library
@@ -101,12 +116,12 @@ func (h *Handlers) HandleNetworkError(c *gin.Context) {
 		wrappedErr := errorid.WrapWithDetails(
 			err,
 			"failed to call payment gateway API",
-			map[string]interface{}{
+			withRequestDetails(c, "network", map[string]interface{}{
 				"api":      "stripe",
 				"endpoint": "https://api.stripe.com/v1/charges",
 				"method":   "POST",
 				"timeout":  "10s",
-			},
+			}),
 		)
 
 		// Use errorid.WriteError helper from library
@@ -129,12 +144,12 @@ func (h *Handlers) HandleAuthError(c *gin.Context) {
 		wrappedErr := errorid.WrapWithDetails(
 			err,
 			"user authentication failed",
-			map[string]interface{}{
+			withRequestDetails(c, "auth", map[string]interface{}{
 				"username":   username,
 				"ip_address": c.ClientIP(),
 				"user_agent": c.Request.UserAgent(),
 				"attempts":   3,
-			},
+			}),
 		)
 
 		// Use errorid.WriteError helper from library
@@ -158,13 +173,13 @@ func (h *Handlers) HandlePaymentError(c *gin.Context) {
 		wrappedErr := errorid.WrapWithDetails(
 			err,
 			"payment processing failed",
-			map[string]interface{}{
+			withRequestDetails(c, "payment", map[string]interface{}{
 				"user_id":     userID,
 				"amount":      amount,
 				"currency":    "USD",
 				"card_last4":  cardLast4,
 				"merchant_id": "merchant_abc123",
-			},
+			}),
 		)
 
 		// Use errorid.WriteError helper from library
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxSenderAttempts = 5
+
+// httpSender posts JSON payloads to one webhook, spacing requests by
+// interval, waiting out 429 Retry-After and retrying 5xx/network errors
+// with backoff. Notifiers call it from their dispatcher worker.
+type httpSender struct {
+	name       string
+	url        string
+	httpClient *http.Client
+	interval   time.Duration
+	// sign, if set, adds headers to every attempt (e.g. a fresh signature)
+	sign func(req *http.Request, body []byte)
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// newHTTPSender creates a sender for url; name is used in logs and errors
+func newHTTPSender(name, url string, interval time.Duration) *httpSender {
+	return &httpSender{
+		name: name,
+		url:  url,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		interval: interval,
+	}
+}
+
+// Post sends a JSON body and returns an error once all attempts have
+// failed; label identifies the payload in logs
+func (s *httpSender) Post(label string, body []byte) error {
+	return s.PostWithHeaders(label, body, nil)
+}
+
+// PostWithHeaders is Post with extra request headers, which may override
+// the default Content-Type
+func (s *httpSender) PostWithHeaders(label string, body []byte, header http.Header) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if wait := s.interval - time.Since(s.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	defer func() { s.last = time.Now() }()
+
+	var lastErr error
+	for attempt := 1; attempt <= maxSenderAttempts; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create %s request: %w", s.name, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if s.sign != nil {
+			s.sign(req, body)
+		}
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			// Drop the URL: webhook URLs and bot endpoints embed secrets
+			if urlErr, ok := err.(*url.Error); ok {
+				err = urlErr.Err
+			}
+			lastErr = err
+			fmt.Fprintf(os.Stderr, "Failed to send to %s (attempt %d): %v\n", s.name, attempt, err)
+			time.Sleep(backoff(attempt))
+			continue
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			retryAfter := time.Second
+			if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+				retryAfter = secondsToDuration(seconds)
+			}
+			lastErr = fmt.Errorf("%s rate limited", s.name)
+			fmt.Fprintf(os.Stderr, "%s rate limited, retrying in %s\n", s.name, retryAfter)
+			time.Sleep(retryAfter)
+		case resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("%s webhook returned error status: %d", s.name, resp.StatusCode)
+			fmt.Fprintf(os.Stderr, "%s webhook returned error status: %d (attempt %d)\n", s.name, resp.StatusCode, attempt)
+			time.Sleep(backoff(attempt))
+		case resp.StatusCode >= 400:
+			return fmt.Errorf("%s webhook returned error status: %d: %s", s.name, resp.StatusCode, strings.TrimSpace(string(respBody)))
+		default:
+			fmt.Printf("Error notification sent to %s: %s\n", s.name, label)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("giving up on %s notification after %d attempts: %w", s.name, maxSenderAttempts, lastErr)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,33 +18,49 @@ func main() {
 	godotenv.Load()
 
 	// Initialize integrations
-	discordWebhook := NewDiscordWebhook(os.Getenv("DISCORD_WEBHOOK_URL"))
+	outbox, err := NewOutbox()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v, notification outbox disabled\n", err)
+	}
+	notifiers := defaultNotifierRegistry().Build(outbox)
 	elkLogger := NewELKLogger(os.Getenv("ELK_URL"))
 
+	// Track errors in memory for periodic digests
+	errorStats := NewErrorStats()
+
 	// Configure error-id library
-	configureErrorTracking(discordWebhook, elkLogger)
+	configureErrorTracking(notifiers, elkLogger, errorStats)
 
 	// Setup server
-	router := setupServer()
+	router := setupServer(outbox)
 
 	// Start error bot
 	bot := startErrorBot()
 	defer bot.Stop()
 
+	// Start error digest scheduler (if enabled)
+	digest := NewDigestScheduler(errorStats)
+	if digest != nil {
+		go digest.Start()
+	}
+
 	// Graceful shutdown
-	setupGracefulShutdown(bot)
+	setupGracefulShutdown(bot, digest, notifiers)
 
 	// Start server
-	printStartupInfo()
+	printStartupInfo(notifiers, outbox)
 	router.Run(":" + getPort())
 }
 
-func setupServer() *gin.Engine {
+func setupServer(outbox *Outbox) *gin.Engine {
 	// Create router WITHOUT default middleware
 	router := gin.New()
 	
-	// Use Gin's logger
-	router.Use(gin.Logger())
+	// Accept or generate X-Request-ID before anything logs the request
+	router.Use(RequestIDMiddleware())
+
+	// Use Gin's logger, with request and error IDs appended
+	router.Use(RequestLogger())
 	
 	// Use errorid.RecoveryMiddleware via adapter (library's middleware!)
 	router.Use(GinRecoveryMiddleware())
@@ -54,15 +71,23 @@ func setupServer() *gin.Engine {
 	// Setup all routes
 	SetupRoutes(router, handlers)
 
+	// Admin endpoints are only exposed with a token
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" && outbox != nil {
+		SetupAdminRoutes(router, NewAdminHandlers(outbox), token)
+	}
+
 	return router
 }
 
 // configureErrorTracking sets up error-id library with integrations
-func configureErrorTracking(discord *DiscordWebhook, elk *ELKLogger) {
+func configureErrorTracking(notifiers *NotifierDispatcher, elk *ELKLogger, stats *ErrorStats) {
 	errorid.Configure(errorid.Config{
 		OnError: func(err *errorid.ErrorWithID) {
-			// Send to Discord
-			discord.SendErrorNotification(err)
+			// Record for digests
+			stats.Record(err)
+
+			// Send to every enabled notifier (Discord, Slack, Teams, ...)
+			notifiers.Dispatch(err)
 		},
 		AsyncCallback:     true, // Non-blocking
 		Logger:            elk,
@@ -85,19 +110,23 @@ func startErrorBot() *ErrorBot {
 }
 
 // setupGracefulShutdown configures graceful shutdown handlers
-func setupGracefulShutdown(bot *ErrorBot) {
+func setupGracefulShutdown(bot *ErrorBot, digest *DigestScheduler, notifiers *NotifierDispatcher) {
 	go func() {
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 		<-sigChan
 		fmt.Println("\nShutting down server...")
 		bot.Stop()
+		if digest != nil {
+			digest.Stop()
+		}
+		notifiers.Close(10 * time.Second)
 		os.Exit(0)
 	}()
 }
 
 // printStartupInfo prints server startup information
-func printStartupInfo() {
+func printStartupInfo(notifiers *NotifierDispatcher, outbox *Outbox) {
 	port := getPort()
 	separator := "============================================================"
 	
@@ -105,8 +134,26 @@ func printStartupInfo() {
 	fmt.Printf("Server starting on port %s\n", port)
 	fmt.Printf("ELK URL: %s\n", os.Getenv("ELK_URL"))
 	fmt.Printf("Discord Webhook: %s\n", maskWebhookURL(os.Getenv("DISCORD_WEBHOOK_URL")))
+	if slackURL := os.Getenv("SLACK_WEBHOOK_URL"); slackURL != "" {
+		fmt.Printf("Slack Webhook: %s\n", maskWebhookURL(slackURL))
+	}
+	if teamsURL := os.Getenv("TEAMS_WEBHOOK_URL"); teamsURL != "" {
+		fmt.Printf("Teams Webhook: %s\n", maskWebhookURL(teamsURL))
+	}
+	fmt.Printf("Notifiers: %s\n", formatNotifierNames(notifiers.Names()))
+	if outbox != nil {
+		counts := outbox.Counts()
+		fmt.Printf("Notification Outbox: %s (%d pending, %d failed)\n", outbox.path, counts[outboxPending], counts[outboxFailed])
+	}
+	if routesFile := os.Getenv("DISCORD_ROUTES_FILE"); routesFile != "" {
+		fmt.Printf("Discord Routes: %s\n", routesFile)
+	}
 	fmt.Printf("Error Bot interval: %s\n", os.Getenv("BOT_INTERVAL"))
+	if schedule := os.Getenv("DIGEST_SCHEDULE"); schedule != "" {
+		fmt.Printf("Error Digest: %s\n", schedule)
+	}
 	fmt.Printf("Environment: %s\n", getEnvironment())
+	fmt.Printf("Service: %s @ %s\n", getRuntimeMetadata().BuildLabel(), getRuntimeMetadata().Location())
 	fmt.Printf("%s\n\n", separator)
 	
 	fmt.Println("Available endpoints:")
@@ -131,6 +178,14 @@ func getEnvironment() string {
 	return env
 }
 
+func getServiceName() string {
+	name := os.Getenv("SERVICE_NAME")
+	if name == "" {
+		return "go-support-id-example"
+	}
+	return name
+}
+
 func getPort() string {
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -139,6 +194,13 @@ func getPort() string {
 	return port
 }
 
+func formatNotifierNames(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
 func maskWebhookURL(url string) string {
 	if url == "" {
 		return "not configured"
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// ErrorMatch selects errors by environment, severity, category, HTTP status,
+// route and detail values. Empty criteria match everything; a list matches when
+// any of its entries matches, and all non-empty criteria must match.
+type ErrorMatch struct {
+	Environment []string          `json:"environment,omitempty"`
+	Severity    []string          `json:"severity,omitempty"`
+	MinSeverity string            `json:"min_severity,omitempty"`
+	Category    []string          `json:"category,omitempty"`
+	Status      []string          `json:"status,omitempty"` // "502" or a class like "5xx"
+	Route       []string          `json:"route,omitempty"`  // path.Match patterns, e.g. "/api/error/*"
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// Matches reports whether err satisfies every configured criterion
+func (m ErrorMatch) Matches(err *errorid.ErrorWithID) bool {
+	if len(m.Environment) > 0 && !matchesAnyFold(m.Environment, getEnvironment()) {
+		return false
+	}
+	if len(m.Severity) > 0 || m.MinSeverity != "" {
+		severity := errorSeverity(err)
+		if len(m.Severity) > 0 && !matchesAnyFold(m.Severity, severity.String()) {
+			return false
+		}
+		if minSeverity, ok := ParseSeverity(m.MinSeverity); m.MinSeverity != "" && ok && severity < minSeverity {
+			return false
+		}
+	}
+	if len(m.Category) > 0 && !matchesAnyFold(m.Category, detailString(err.Details, "category")) {
+		return false
+	}
+	if len(m.Status) > 0 && !matchesStatus(m.Status, detailString(err.Details, "http_status")) {
+		return false
+	}
+	if len(m.Route) > 0 && !matchesRoute(m.Route, detailString(err.Details, "http_route")) {
+		return false
+	}
+	for key, want := range m.Details {
+		if _, ok := err.Details[key]; !ok || !strings.EqualFold(detailString(err.Details, key), want) {
+			return false
+		}
+	}
+	return true
+}
+
+// detailString returns a detail value formatted as a string, or "" if absent
+func detailString(details map[string]interface{}, key string) string {
+	value, ok := details[key]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func matchesAnyFold(candidates []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, candidate := range candidates {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesStatus(candidates []string, value string) bool {
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range candidates {
+		candidate = strings.ToLower(strings.TrimSpace(candidate))
+		if strings.HasSuffix(candidate, "xx") && len(candidate) == 3 {
+			if class, err := strconv.Atoi(candidate[:1]); err == nil && status/100 == class {
+				return true
+			}
+			continue
+		}
+		if code, err := strconv.Atoi(candidate); err == nil && code == status {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesRoute(patterns []string, route string) bool {
+	if route == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// RuntimeMetadata describes the process, host and build that produced an error
+type RuntimeMetadata struct {
+	Service      string
+	Version      string
+	Hostname     string
+	PID          int
+	ContainerID  string
+	PodName      string
+	PodNamespace string
+	NodeName     string
+	GoVersion    string
+	VCSRevision  string
+	VCSTime      string
+	VCSModified  bool
+}
+
+// getRuntimeMetadata returns metadata collected once at first use
+var getRuntimeMetadata = sync.OnceValue(loadRuntimeMetadata)
+
+// loadRuntimeMetadata gathers metadata from the environment and debug.ReadBuildInfo
+func loadRuntimeMetadata() RuntimeMetadata {
+	hostname, _ := os.Hostname()
+
+	meta := RuntimeMetadata{
+		Service:      getServiceName(),
+		Version:      os.Getenv("SERVICE_VERSION"),
+		Hostname:     hostname,
+		PID:          os.Getpid(),
+		ContainerID:  os.Getenv("CONTAINER_ID"),
+		PodName:      os.Getenv("POD_NAME"),
+		PodNamespace: os.Getenv("POD_NAMESPACE"),
+		NodeName:     os.Getenv("NODE_NAME"),
+		GoVersion:    runtime.Version(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if meta.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			meta.Version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				meta.VCSRevision = setting.Value
+			case "vcs.time":
+				meta.VCSTime = setting.Value
+			case "vcs.modified":
+				meta.VCSModified = setting.Value == "true"
+			}
+		}
+	}
+
+	return meta
+}
+
+// Fields returns the non-empty metadata as flat ELK document fields
+func (m RuntimeMetadata) Fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"service":    m.Service,
+		"hostname":   m.Hostname,
+		"pid":        m.PID,
+		"go_version": m.GoVersion,
+	}
+
+	optional := map[string]string{
+		"service_version": m.Version,
+		"container_id":    m.ContainerID,
+		"pod_name":        m.PodName,
+		"pod_namespace":   m.PodNamespace,
+		"node_name":       m.NodeName,
+		"vcs_revision":    m.VCSRevision,
+		"vcs_time":        m.VCSTime,
+	}
+	for key, value := range optional {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	if m.VCSModified {
+		fields["vcs_modified"] = true
+	}
+
+	return fields
+}
+
+// Location returns the most specific place the process runs: pod, container or host
+func (m RuntimeMetadata) Location() string {
+	switch {
+	case m.PodName != "" && m.PodNamespace != "":
+		return m.PodNamespace + "/" + m.PodName
+	case m.PodName != "":
+		return m.PodName
+	case m.ContainerID != "":
+		return m.Hostname + " (" + shortRevision(m.ContainerID) + ")"
+	default:
+		return m.Hostname
+	}
+}
+
+// BuildLabel returns a short "service version (revision)" label
+func (m RuntimeMetadata) BuildLabel() string {
+	label := m.Service
+	if m.Version != "" {
+		label += " " + m.Version
+	}
+	if m.VCSRevision != "" {
+		revision := shortRevision(m.VCSRevision)
+		if m.VCSModified {
+			revision += "-dirty"
+		}
+		label += " (" + revision + ")"
+	}
+	return label + " • " + m.GoVersion
+}
+
+// shortRevision shortens commit hashes and container IDs to 12 characters
+func shortRevision(s string) string {
+	if len(s) > 12 {
+		return s[:12]
+	}
+	return s
+}
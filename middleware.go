@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -13,11 +14,47 @@ func GinRecoveryMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Create a wrapper that adapts Gin to http.Handler
 		handler := errorid.RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer recoverWithRequestDetails(c)
+
 			// Continue with Gin's processing
 			c.Next()
 		}))
 
+		// Hold back error responses so X-Error-ID can be set from the
+		// error_id in the body, including for panics recovered by the library
+		writer := &errorIDWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			c.Writer = writer.ResponseWriter
+			if errorID := writer.flush(); errorID != "" {
+				c.Set(errorIDKey, errorID)
+			}
+		}()
+
 		// Execute the wrapped handler
-		handler.ServeHTTP(c.Writer, c.Request)
+		handler.ServeHTTP(writer, c.Request)
+	}
+}
+
+// recoverWithRequestDetails turns a handler panic into a tracked error the
+// way errorid.RecoveryMiddleware does, but with the request ID, method and
+// route in its details, which the library cannot know. The library
+// middleware stays in place for anything that panics outside c.Next().
+func recoverWithRequestDetails(c *gin.Context) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+
+	panicErr, ok := recovered.(error)
+	if !ok {
+		panicErr = fmt.Errorf("%v", recovered)
 	}
+	err := errorid.WrapWithDetails(panicErr, panicRecoveredContext,
+		withRequestDetails(c, "panic", map[string]interface{}{}))
+	c.Abort()
+	errorid.WriteError(c.Writer, err)
 }
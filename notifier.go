@@ -0,0 +1,544 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+const defaultNotifierQueueSize = 100
+
+// Notifier delivers error notifications to one target (Discord, Slack, ...).
+// Notify is called from the notifier's own worker, one error at a time, so
+// it may block while delivering.
+type Notifier interface {
+	Name() string
+	Notify(err *errorid.ErrorWithID) error
+}
+
+// Delivery describes one attempt to deliver a notification
+type Delivery struct {
+	// Replay marks a retry from the outbox. The first attempt already went
+	// through sampling and aggregation, so a replay must not be dropped.
+	Replay bool
+	// Targets limits the attempt to these targets (see targetErrors);
+	// empty means every target the error routes to
+	Targets []string
+}
+
+// deliveryNotifier is implemented by notifiers that act on Delivery or
+// finish after Notify would return, e.g. when sends are batched. done must
+// be called exactly once, possibly after NotifyDelivery returned.
+type deliveryNotifier interface {
+	NotifyDelivery(err *errorid.ErrorWithID, delivery Delivery, done func(error))
+}
+
+// targetErrors reports the targets (webhook IDs, chat IDs, recipient
+// lists) a notifier with several targets failed to deliver to, so the
+// outbox retries only those. Keys must not contain secrets such as tokens.
+type targetErrors map[string]error
+
+// Error implements error
+func (e targetErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, target := range e.Targets() {
+		messages = append(messages, e[target].Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Targets returns the failed targets, sorted
+func (e targetErrors) Targets() []string {
+	targets := make([]string, 0, len(e))
+	for target := range e {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// err returns e, or nil when no target failed
+func (e targetErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// includes reports whether target is part of the attempt
+func (d Delivery) includes(target string) bool {
+	return len(d.Targets) == 0 || containsString(d.Targets, target)
+}
+
+// notifierCloser is implemented by notifiers that buffer work and need to
+// flush it on shutdown
+type notifierCloser interface {
+	Close(timeout time.Duration)
+}
+
+// NotifierFactory builds a notifier from the environment. It returns nil
+// when the notifier is not configured (e.g. no webhook URL).
+type NotifierFactory func() Notifier
+
+// NotifierRegistry holds the known notifiers by name, in registration order
+type NotifierRegistry struct {
+	names     []string
+	factories map[string]NotifierFactory
+}
+
+// NewNotifierRegistry creates an empty registry
+func NewNotifierRegistry() *NotifierRegistry {
+	return &NotifierRegistry{factories: make(map[string]NotifierFactory)}
+}
+
+// Register adds a notifier factory under name
+func (r *NotifierRegistry) Register(name string, factory NotifierFactory) {
+	if _, ok := r.factories[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.factories[name] = factory
+}
+
+// defaultNotifierRegistry registers every built-in notifier
+func defaultNotifierRegistry() *NotifierRegistry {
+	r := NewNotifierRegistry()
+	r.Register("discord", func() Notifier {
+		if os.Getenv("DISCORD_WEBHOOK_URL") == "" && os.Getenv("DISCORD_ROUTES_FILE") == "" {
+			return nil
+		}
+		return NewDiscordWebhook(os.Getenv("DISCORD_WEBHOOK_URL"))
+	})
+	r.Register("slack", func() Notifier {
+		if slack := NewSlackWebhook(os.Getenv("SLACK_WEBHOOK_URL")); slack != nil {
+			return slack
+		}
+		return nil
+	})
+	r.Register("teams", func() Notifier {
+		if teams := NewTeamsWebhook(os.Getenv("TEAMS_WEBHOOK_URL")); teams != nil {
+			return teams
+		}
+		return nil
+	})
+	r.Register("email", func() Notifier {
+		email, err := NewEmailNotifier()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v, email notifications disabled\n", err)
+			return nil
+		}
+		if email != nil {
+			return email
+		}
+		return nil
+	})
+	r.Register("pagerduty", func() Notifier {
+		if pagerDuty := NewPagerDutyNotifier(); pagerDuty != nil {
+			return pagerDuty
+		}
+		return nil
+	})
+	r.Register("webhook", func() Notifier {
+		webhook, err := NewWebhookNotifier()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v, webhook notifications disabled\n", err)
+			return nil
+		}
+		if webhook != nil {
+			return webhook
+		}
+		return nil
+	})
+	r.Register("cloudevents", func() Notifier {
+		if cloudEvents := NewCloudEventsNotifier(); cloudEvents != nil {
+			return cloudEvents
+		}
+		return nil
+	})
+	r.Register("telegram", func() Notifier {
+		telegram, err := NewTelegramNotifier()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v, Telegram notifications disabled\n", err)
+			return nil
+		}
+		if telegram != nil {
+			return telegram
+		}
+		return nil
+	})
+	r.Register("file", func() Notifier {
+		if file := NewFileNotifier(); file != nil {
+			return file
+		}
+		return nil
+	})
+	r.Register("sentry", func() Notifier {
+		sentry, err := NewSentryNotifier()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v, Sentry sink disabled\n", err)
+			return nil
+		}
+		if sentry != nil {
+			return sentry
+		}
+		return nil
+	})
+	return r
+}
+
+// Build creates the dispatcher for the notifiers selected by NOTIFIERS
+// (comma-separated names). Without NOTIFIERS every configured notifier is used.
+// With an outbox every notification is recorded before it is queued, and
+// entries still pending from a previous run are redelivered.
+func (r *NotifierRegistry) Build(outbox *Outbox) *NotifierDispatcher {
+	names := r.names
+	if raw := os.Getenv("NOTIFIERS"); raw != "" {
+		names = splitNames(raw)
+	}
+
+	fallbacks, err := loadFallbackChains(r.names)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v, using <NAME>_FALLBACK chains only\n", err)
+	}
+
+	dispatcher := &NotifierDispatcher{
+		outbox:    outbox,
+		fallbacks: fallbacks,
+		health:    loadNotifierHealth(),
+	}
+	for _, name := range names {
+		factory, ok := r.factories[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown notifier %q in NOTIFIERS, skipping\n", name)
+			continue
+		}
+		notifier := factory()
+		if notifier == nil {
+			if os.Getenv("NOTIFIERS") != "" {
+				fmt.Fprintf(os.Stderr, "Notifier %q is enabled but not configured, skipping\n", name)
+			}
+			continue
+		}
+
+		filter, err := loadNotifierFilter(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v, sending all errors to %s\n", err, name)
+		}
+		worker := newNotifierWorker(notifier, filter, outbox, dispatcher.notified)
+		worker.fallbackOnly = os.Getenv(strings.ToUpper(name)+"_FALLBACK_ONLY") == "true"
+		dispatcher.workers = append(dispatcher.workers, worker)
+	}
+
+	for _, name := range fallbacks.Names() {
+		if dispatcher.worker(name) == nil {
+			fmt.Fprintf(os.Stderr, "Fallback notifier %q is not enabled, it will be skipped\n", name)
+		}
+	}
+
+	if outbox != nil {
+		outbox.Start(dispatcher.redeliver)
+	}
+	return dispatcher
+}
+
+// loadNotifierFilter reads the <NAME>_FILTER environment variable, a JSON
+// ErrorMatch such as {"min_severity":"error"}; nil means no filter
+func loadNotifierFilter(name string) (*ErrorMatch, error) {
+	variable := strings.ToUpper(name) + "_FILTER"
+	raw := os.Getenv(variable)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var filter ErrorMatch
+	if err := json.Unmarshal([]byte(raw), &filter); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", variable, err)
+	}
+	return &filter, nil
+}
+
+// NotifierDispatcher fans errors out to every enabled notifier
+type NotifierDispatcher struct {
+	workers   []*notifierWorker
+	outbox    *Outbox
+	fallbacks *fallbackChains
+	health    *notifierHealth
+}
+
+// notifierJob is one queued notification
+type notifierJob struct {
+	err *errorid.ErrorWithID
+	// entryID is the outbox entry, if the job is recorded in the outbox
+	entryID string
+	// redelivery marks a retry from the outbox; it has already been
+	// through the fallback chain
+	redelivery bool
+	// fallbackFor is the notifier that failed and chain the fallbacks still
+	// left to try if this one fails too
+	fallbackFor string
+	chain       []string
+	// targets limits a redelivery to the targets that failed before
+	targets []string
+	// healthAlert marks a meta-alert about a failing notifier
+	healthAlert bool
+}
+
+// Dispatch hands err to each notifier whose filter matches. It never
+// blocks: every notifier has its own queue and worker. Notifications that
+// don't fit in a full queue stay in the outbox and are retried from there.
+func (d *NotifierDispatcher) Dispatch(err *errorid.ErrorWithID) {
+	for _, w := range d.workers {
+		if w.fallbackOnly || (w.filter != nil && !w.filter.Matches(err)) {
+			continue
+		}
+
+		job := notifierJob{err: err}
+		if d.outbox != nil {
+			job.entryID = d.outbox.Add(w.notifier.Name(), err)
+		}
+		if !w.Enqueue(job) && job.entryID != "" {
+			d.outbox.Release(job.entryID)
+		}
+	}
+}
+
+// redeliver queues an outbox entry with its notifier; filters already
+// matched when the entry was recorded
+func (d *NotifierDispatcher) redeliver(entry OutboxEntry) bool {
+	w := d.worker(entry.Notifier)
+	if w == nil {
+		return false
+	}
+	return w.Enqueue(notifierJob{
+		err:        entry.Error.ErrorWithID(),
+		entryID:    entry.ID,
+		redelivery: entry.Attempts > 0,
+		targets:    entry.Targets,
+	})
+}
+
+// worker returns the enabled notifier called name, or nil
+func (d *NotifierDispatcher) worker(name string) *notifierWorker {
+	for _, w := range d.workers {
+		if w.notifier.Name() == name {
+			return w
+		}
+	}
+	return nil
+}
+
+// notified receives the outcome of every delivery: it updates notifier
+// health and moves failed notifications along their fallback chain
+func (d *NotifierDispatcher) notified(name string, job notifierJob, notifyErr error) {
+	if d.health != nil {
+		var alert *errorid.ErrorWithID
+		if notifyErr != nil {
+			alert = d.health.Failure(name, notifyErr)
+		} else {
+			alert = d.health.Success(name)
+		}
+		if alert != nil {
+			d.sendHealthAlert(name, alert)
+		}
+	}
+
+	if notifyErr == nil || job.redelivery || job.healthAlert {
+		return
+	}
+	if job.fallbackFor != "" {
+		d.fallback(job.fallbackFor, job.chain, job.err)
+		return
+	}
+	if chain := d.fallbacks.Chain(name, job.err); len(chain) > 0 {
+		d.fallback(name, chain, withFallbackDetails(job.err, name, notifyErr))
+	}
+}
+
+// fallback queues err with the first enabled notifier in chain, passing the
+// rest of the chain along in case that one fails too
+func (d *NotifierDispatcher) fallback(primary string, chain []string, err *errorid.ErrorWithID) {
+	for i, name := range chain {
+		w := d.worker(name)
+		if w == nil || name == primary {
+			continue
+		}
+		job := notifierJob{err: err, fallbackFor: primary, chain: chain[i+1:]}
+		if w.Enqueue(job) {
+			fmt.Printf("%s could not deliver %s, falling back to %s\n", primary, err.ID, name)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "No fallback left for %s notification %s\n", primary, err.ID)
+}
+
+// sendHealthAlert sends a meta-alert about notifier failing to the
+// NOTIFIER_HEALTH_ALERT notifiers other than the failing one
+func (d *NotifierDispatcher) sendHealthAlert(failing string, alert *errorid.ErrorWithID) {
+	fmt.Fprintf(os.Stderr, "Notifier health: %s\n", alert.Context)
+	for _, name := range d.health.alertTo {
+		if name == failing {
+			continue
+		}
+		if w := d.worker(name); w != nil {
+			w.Enqueue(notifierJob{err: alert, healthAlert: true})
+		}
+	}
+}
+
+// Names returns the names of the enabled notifiers
+func (d *NotifierDispatcher) Names() []string {
+	names := make([]string, 0, len(d.workers))
+	for _, w := range d.workers {
+		names = append(names, w.notifier.Name())
+	}
+	return names
+}
+
+// Close drains every notifier queue, waiting at most timeout in total.
+// Notifications that are still undelivered stay pending in the outbox.
+func (d *NotifierDispatcher) Close(timeout time.Duration) {
+	if d.outbox != nil {
+		d.outbox.StopRetries()
+	}
+	deadline := time.Now().Add(timeout)
+	for _, w := range d.workers {
+		w.Close(time.Until(deadline))
+	}
+	if d.outbox != nil {
+		d.outbox.Close()
+	}
+}
+
+// notifierWorker is one notifier with its filter and delivery queue
+type notifierWorker struct {
+	notifier Notifier
+	filter   *ErrorMatch
+	outbox   *Outbox
+	// fallbackOnly workers only receive fallbacks and health alerts
+	fallbackOnly bool
+	// onResult is told the outcome of every delivery
+	onResult func(name string, job notifierJob, err error)
+
+	queue chan notifierJob
+	done  chan struct{}
+	// mu guards closed so Enqueue never writes to the closed queue
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newNotifierWorker starts a worker sized by <NAME>_QUEUE_SIZE, falling
+// back to NOTIFIER_QUEUE_SIZE
+func newNotifierWorker(notifier Notifier, filter *ErrorMatch, outbox *Outbox, onResult func(name string, job notifierJob, err error)) *notifierWorker {
+	size := envInt(strings.ToUpper(notifier.Name())+"_QUEUE_SIZE", envInt("NOTIFIER_QUEUE_SIZE", defaultNotifierQueueSize))
+	if size <= 0 {
+		size = defaultNotifierQueueSize
+	}
+
+	w := &notifierWorker{
+		notifier: notifier,
+		filter:   filter,
+		outbox:   outbox,
+		onResult: onResult,
+		queue:    make(chan notifierJob, size),
+		done:     make(chan struct{}),
+	}
+
+	go w.run()
+	return w
+}
+
+// Enqueue queues job and reports whether it was accepted; it is rejected
+// when the queue is full or closed
+func (w *notifierWorker) Enqueue(job notifierJob) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		fmt.Fprintf(os.Stderr, "%s notifier closed, not queueing notification: %s\n", w.notifier.Name(), job.err.ID)
+		return false
+	}
+
+	select {
+	case w.queue <- job:
+		return true
+	default:
+		fmt.Fprintf(os.Stderr, "%s queue full, not queueing notification: %s\n", w.notifier.Name(), job.err.ID)
+		return false
+	}
+}
+
+// Close stops accepting errors, waits for the queue to drain and then
+// closes the notifier itself
+func (w *notifierWorker) Close(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-time.After(time.Until(deadline)):
+		fmt.Fprintf(os.Stderr, "%s queue did not drain within %s, %d notifications lost\n", w.notifier.Name(), timeout, len(w.queue))
+	}
+
+	if closer, ok := w.notifier.(notifierCloser); ok {
+		closer.Close(time.Until(deadline))
+	}
+}
+
+// run delivers queued errors one at a time
+func (w *notifierWorker) run() {
+	defer close(w.done)
+	for job := range w.queue {
+		w.notify(job)
+	}
+}
+
+// notify calls the notifier, isolating failures and panics so one broken
+// notifier can't affect the others, and records the outcome in the outbox
+// once the notifier reports it
+func (w *notifierWorker) notify(job notifierJob) {
+	w.call(job, func(notifyErr error) {
+		if notifyErr != nil {
+			fmt.Fprintf(os.Stderr, "%s notification failed for %s: %v\n", w.notifier.Name(), job.err.ID, notifyErr)
+		}
+
+		if job.entryID != "" {
+			if notifyErr != nil {
+				w.outbox.Failed(job.entryID, notifyErr)
+			} else {
+				w.outbox.Delivered(job.entryID)
+			}
+		}
+		if w.onResult != nil {
+			w.onResult(w.notifier.Name(), job, notifyErr)
+		}
+	})
+}
+
+// call invokes NotifyDelivery, or Notify for plain notifiers, turning a
+// panic into an error. done is called exactly once, possibly later.
+func (w *notifierWorker) call(job notifierJob, done func(error)) {
+	var once sync.Once
+	finish := func(notifyErr error) { once.Do(func() { done(notifyErr) }) }
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "%s notifier panicked on %s: %v\n", w.notifier.Name(), job.err.ID, r)
+			finish(fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	if notifier, ok := w.notifier.(deliveryNotifier); ok {
+		notifier.NotifyDelivery(job.err, Delivery{Replay: job.redelivery, Targets: job.targets}, finish)
+		return
+	}
+	finish(w.notifier.Notify(job.err))
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// Outbox entry states
+const (
+	outboxPending   = "pending"
+	outboxDelivered = "delivered"
+	outboxFailed    = "failed"
+)
+
+const (
+	defaultOutboxFile          = "notification_outbox.jsonl"
+	defaultOutboxMaxAttempts   = 10
+	defaultOutboxRetryInterval = time.Minute
+	defaultOutboxKeepDelivered = 200
+	maxOutboxRetryDelay        = time.Hour
+	outboxPollInterval         = 5 * time.Second
+	maxOutboxLine              = 16 * 1024 * 1024
+)
+
+// OutboxEntry is one notification for one notifier. Targets lists the
+// targets (webhook IDs, chat IDs, recipients) the last attempt failed for;
+// retries go to those only, and empty means every target.
+type OutboxEntry struct {
+	ID            string      `json:"id"`
+	Notifier      string      `json:"notifier"`
+	Status        string      `json:"status"`
+	Attempts      int         `json:"attempts"`
+	LastError     string      `json:"last_error,omitempty"`
+	Targets       []string    `json:"targets,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+	NextAttemptAt time.Time   `json:"next_attempt_at"`
+	Error         OutboxError `json:"error"`
+}
+
+// OutboxError is the stored form of an errorid.ErrorWithID
+type OutboxError struct {
+	ID         string                 `json:"id"`
+	Context    string                 `json:"context"`
+	Message    string                 `json:"message"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	StackTrace string                 `json:"stack_trace,omitempty"`
+}
+
+// ErrorWithID rebuilds the error for redelivery
+func (e OutboxError) ErrorWithID() *errorid.ErrorWithID {
+	return &errorid.ErrorWithID{
+		ID:         e.ID,
+		Original:   errors.New(e.Message),
+		Context:    e.Context,
+		Details:    e.Details,
+		StackTrace: e.StackTrace,
+	}
+}
+
+// Retry errors
+var (
+	errOutboxNotFound  = errors.New("outbox entry not found")
+	errOutboxDelivered = errors.New("outbox entry was already delivered")
+	errOutboxInFlight  = errors.New("outbox entry is being delivered right now")
+)
+
+// Outbox records every notification before it is sent and keeps it until
+// the notifier reports success. Entries live in a JSON Lines journal: each
+// change appends the entry's new state, and the journal is compacted on
+// start and whenever it grows well past the live entries. Pending entries
+// are retried with backoff, including those left over from a previous run.
+type Outbox struct {
+	path          string
+	maxAttempts   int
+	retryInterval time.Duration
+	keepDelivered int
+
+	mu       sync.Mutex
+	file     *os.File
+	entries  map[string]*OutboxEntry
+	inFlight map[string]bool
+	lines    int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewOutbox opens the outbox from OUTBOX_FILE (default
+// notification_outbox.jsonl), with OUTBOX_MAX_ATTEMPTS, OUTBOX_RETRY_INTERVAL
+// and OUTBOX_KEEP_DELIVERED. It returns nil when OUTBOX_FILE=off.
+func NewOutbox() (*Outbox, error) {
+	path := os.Getenv("OUTBOX_FILE")
+	if path == "off" {
+		return nil, nil
+	}
+	if path == "" {
+		path = defaultOutboxFile
+	}
+
+	retryInterval := defaultOutboxRetryInterval
+	if raw := os.Getenv("OUTBOX_RETRY_INTERVAL"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			retryInterval = d
+		} else {
+			fmt.Fprintf(os.Stderr, "Invalid OUTBOX_RETRY_INTERVAL=%q, using %s\n", raw, retryInterval)
+		}
+	}
+
+	o := &Outbox{
+		path:          path,
+		maxAttempts:   envInt("OUTBOX_MAX_ATTEMPTS", defaultOutboxMaxAttempts),
+		retryInterval: retryInterval,
+		keepDelivered: envInt("OUTBOX_KEEP_DELIVERED", defaultOutboxKeepDelivered),
+		entries:       make(map[string]*OutboxEntry),
+		inFlight:      make(map[string]bool),
+	}
+	if o.maxAttempts <= 0 {
+		o.maxAttempts = defaultOutboxMaxAttempts
+	}
+	if o.keepDelivered < 0 {
+		o.keepDelivered = defaultOutboxKeepDelivered
+	}
+
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// load replays the journal; the last line for an entry wins. A torn last
+// line from a crash mid-write is skipped.
+func (o *Outbox) load() error {
+	file, err := os.Open(o.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read outbox: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxOutboxLine)
+	for line := 1; scanner.Scan(); line++ {
+		var entry OutboxEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.ID == "" {
+			fmt.Fprintf(os.Stderr, "Skipping unreadable outbox line %d in %s\n", line, o.path)
+			continue
+		}
+		o.entries[entry.ID] = &entry
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read outbox %s: %w", o.path, err)
+	}
+	return nil
+}
+
+// compact prunes old delivered entries and rewrites the journal with one
+// line per entry; callers hold o.mu
+func (o *Outbox) compact() error {
+	var delivered []*OutboxEntry
+	for _, entry := range o.entries {
+		if entry.Status == outboxDelivered {
+			delivered = append(delivered, entry)
+		}
+	}
+	if len(delivered) > o.keepDelivered {
+		sort.Slice(delivered, func(i, j int) bool { return delivered[i].UpdatedAt.After(delivered[j].UpdatedAt) })
+		for _, entry := range delivered[o.keepDelivered:] {
+			delete(o.entries, entry.ID)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(o.path), ".outbox-*")
+	if err != nil {
+		return fmt.Errorf("failed to compact outbox: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range o.sorted("") {
+		if err := encoder.Encode(entry); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to compact outbox: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact outbox: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact outbox: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact outbox: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), o.path); err != nil {
+		return fmt.Errorf("failed to compact outbox: %w", err)
+	}
+
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file, err = os.OpenFile(o.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open outbox: %w", err)
+	}
+	o.lines = len(o.entries)
+	return nil
+}
+
+// write appends entry's state to the journal and syncs it to disk before
+// returning; callers hold o.mu
+func (o *Outbox) write(entry *OutboxEntry) {
+	if o.file == nil {
+		fmt.Fprintf(os.Stderr, "Outbox closed, entry %s not persisted\n", entry.ID)
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode outbox entry %s: %v\n", entry.ID, err)
+		return
+	}
+	if _, err := o.file.Write(append(data, '\n')); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write outbox entry %s: %v\n", entry.ID, err)
+		return
+	}
+	if err := o.file.Sync(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to sync outbox: %v\n", err)
+	}
+
+	o.lines++
+	if o.lines > 2*len(o.entries)+1000 {
+		if err := o.compact(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}
+}
+
+// Add records a notification for notifier before it is queued and returns
+// its entry ID. The entry is in flight until Delivered, Failed or Release.
+func (o *Outbox) Add(notifier string, err *errorid.ErrorWithID) string {
+	details, _ := sanitizeDetails(err.Details)
+	now := time.Now().UTC()
+	entry := &OutboxEntry{
+		ID:            notifier + ":" + err.ID,
+		Notifier:      notifier,
+		Status:        outboxPending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		NextAttemptAt: now,
+		Error: OutboxError{
+			ID:         err.ID,
+			Context:    err.Context,
+			Message:    errorMessage(err.Original),
+			Details:    details,
+			StackTrace: err.StackTrace,
+		},
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.entries[entry.ID] = entry
+	o.inFlight[entry.ID] = true
+	o.write(entry)
+	return entry.ID
+}
+
+// Delivered marks an entry as sent
+func (o *Outbox) Delivered(id string) {
+	o.update(id, func(entry *OutboxEntry) bool {
+		entry.Attempts++
+		entry.Status = outboxDelivered
+		entry.LastError = ""
+		entry.Targets = nil
+		return true
+	})
+}
+
+// Failed records a failed attempt and schedules the next one with
+// exponential backoff; after OUTBOX_MAX_ATTEMPTS the entry is failed for good
+// until retried through the admin endpoint. When only some targets failed
+// (targetErrors), later attempts go to those targets only.
+func (o *Outbox) Failed(id string, sendErr error) {
+	o.update(id, func(entry *OutboxEntry) bool {
+		entry.Attempts++
+		entry.LastError = sendErr.Error()
+		var failed targetErrors
+		if errors.As(sendErr, &failed) {
+			entry.Targets = failed.Targets()
+		}
+		if entry.Attempts >= o.maxAttempts {
+			entry.Status = outboxFailed
+			return true
+		}
+		delay := o.retryInterval << uint(entry.Attempts-1)
+		if delay > maxOutboxRetryDelay || delay <= 0 {
+			delay = maxOutboxRetryDelay
+		}
+		entry.NextAttemptAt = time.Now().UTC().Add(delay)
+		return true
+	})
+}
+
+// Release returns an entry that could not be queued to the retry loop
+// without counting an attempt
+func (o *Outbox) Release(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.inFlight, id)
+}
+
+// Retry makes a failed or pending entry due immediately. Entries that are
+// delivered or currently being delivered are left alone, so a retry never
+// sends a notification twice.
+func (o *Outbox) Retry(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, ok := o.entries[id]
+	switch {
+	case !ok:
+		return errOutboxNotFound
+	case entry.Status == outboxDelivered:
+		return errOutboxDelivered
+	case o.inFlight[id]:
+		return errOutboxInFlight
+	}
+
+	entry.Status = outboxPending
+	entry.NextAttemptAt = time.Now().UTC()
+	entry.UpdatedAt = entry.NextAttemptAt
+	o.write(entry)
+	return nil
+}
+
+// update ends an attempt: it clears the entry's in-flight flag and applies
+// change, persisting the entry when change reports it modified it
+func (o *Outbox) update(id string, change func(entry *OutboxEntry) bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.inFlight, id)
+	entry, ok := o.entries[id]
+	if !ok || !change(entry) {
+		return
+	}
+	entry.UpdatedAt = time.Now().UTC()
+	o.write(entry)
+}
+
+// due returns pending entries whose next attempt has come and marks them
+// in flight
+func (o *Outbox) due(now time.Time) []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var due []OutboxEntry
+	for _, entry := range o.sorted(outboxPending) {
+		if o.inFlight[entry.ID] || entry.NextAttemptAt.After(now) {
+			continue
+		}
+		o.inFlight[entry.ID] = true
+		due = append(due, *entry)
+	}
+	return due
+}
+
+// Start runs the retry loop. redeliver queues an entry with its notifier
+// and returns false when that is not possible (queue full, notifier
+// disabled); the entry is then tried again later.
+func (o *Outbox) Start(redeliver func(entry OutboxEntry) bool) {
+	o.stop = make(chan struct{})
+	o.done = make(chan struct{})
+
+	go func() {
+		defer close(o.done)
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			for _, entry := range o.due(time.Now()) {
+				if !redeliver(entry) {
+					o.Release(entry.ID)
+				}
+			}
+			select {
+			case <-o.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// StopRetries stops the retry loop
+func (o *Outbox) StopRetries() {
+	if o.stop == nil {
+		return
+	}
+	select {
+	case <-o.stop:
+	default:
+		close(o.stop)
+	}
+	<-o.done
+}
+
+// Close stops the retry loop and closes the journal. Entries that are
+// still pending are retried on the next start.
+func (o *Outbox) Close() {
+	o.StopRetries()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.file != nil {
+		o.file.Close()
+		o.file = nil
+	}
+}
+
+// List returns entries with the given status ("" for all), oldest first
+func (o *Outbox) List(status string) []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	sorted := o.sorted(status)
+	entries := make([]OutboxEntry, 0, len(sorted))
+	for _, entry := range sorted {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// Get returns one entry
+func (o *Outbox) Get(id string) (OutboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry, ok := o.entries[id]
+	if !ok {
+		return OutboxEntry{}, false
+	}
+	return *entry, true
+}
+
+// Counts returns the number of entries per status
+func (o *Outbox) Counts() map[string]int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	counts := map[string]int{outboxPending: 0, outboxDelivered: 0, outboxFailed: 0}
+	for _, entry := range o.entries {
+		counts[entry.Status]++
+	}
+	return counts
+}
+
+// sorted returns entries with the given status ("" for all) by creation
+// time; callers hold o.mu
+func (o *Outbox) sorted(status string) []*OutboxEntry {
+	entries := make([]*OutboxEntry, 0, len(o.entries))
+	for _, entry := range o.entries {
+		if status == "" || entry.Status == status {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].ID < entries[j].ID
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// fakeTargetNotifier fails the targets in failing and reports every
+// Delivery it is asked for; done is called from another goroutine, as a
+// batching notifier would
+type fakeTargetNotifier struct {
+	targets    []string
+	failing    map[string]bool
+	deliveries chan Delivery
+}
+
+func (f *fakeTargetNotifier) Name() string { return "fake" }
+
+func (f *fakeTargetNotifier) Notify(err *errorid.ErrorWithID) error {
+	result := make(chan error, 1)
+	f.NotifyDelivery(err, Delivery{}, func(sendErr error) { result <- sendErr })
+	return <-result
+}
+
+func (f *fakeTargetNotifier) NotifyDelivery(err *errorid.ErrorWithID, delivery Delivery, done func(error)) {
+	failed := targetErrors{}
+	for _, target := range f.targets {
+		if delivery.includes(target) && f.failing[target] {
+			failed[target] = errors.New(target + " is down")
+		}
+	}
+	f.deliveries <- delivery
+	go done(failed.err())
+}
+
+func newTestOutbox(t *testing.T) *Outbox {
+	t.Helper()
+	t.Setenv("OUTBOX_FILE", filepath.Join(t.TempDir(), "outbox.jsonl"))
+	outbox, err := NewOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(outbox.Close)
+	return outbox
+}
+
+// waitEntry polls until the entry has made attempts attempts
+func waitEntry(t *testing.T, outbox *Outbox, id string, attempts int) OutboxEntry {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if entry, ok := outbox.Get(id); ok && entry.Attempts >= attempts {
+			return entry
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("entry %s did not reach %d attempts", id, attempts)
+	return OutboxEntry{}
+}
+
+func TestOutboxRetriesOnlyFailedTargets(t *testing.T) {
+	outbox := newTestOutbox(t)
+	notifier := &fakeTargetNotifier{
+		targets:    []string{"chat-a", "chat-b", "chat-c"},
+		failing:    map[string]bool{"chat-b": true},
+		deliveries: make(chan Delivery, 10),
+	}
+	worker := newNotifierWorker(notifier, nil, outbox, nil)
+	defer worker.Close(time.Second)
+
+	err := &errorid.ErrorWithID{ID: "ERR-20251023-A3F9B2", Original: errors.New("boom")}
+	id := outbox.Add(notifier.Name(), err)
+	worker.Enqueue(notifierJob{err: err, entryID: id})
+
+	entry := waitEntry(t, outbox, id, 1)
+	if entry.Status != outboxPending || !reflect.DeepEqual(entry.Targets, []string{"chat-b"}) {
+		t.Fatalf("after a partial failure: status %s, targets %v", entry.Status, entry.Targets)
+	}
+
+	// The redelivery is a replay limited to the failed target
+	notifier.failing = nil
+	worker.Enqueue(notifierJob{err: err, entryID: id, redelivery: true, targets: entry.Targets})
+	<-notifier.deliveries
+	if replay := <-notifier.deliveries; !replay.Replay || !reflect.DeepEqual(replay.Targets, []string{"chat-b"}) {
+		t.Errorf("redelivery = %+v, want a replay to chat-b", replay)
+	}
+
+	entry = waitEntry(t, outbox, id, 2)
+	if entry.Status != outboxDelivered || len(entry.Targets) != 0 {
+		t.Errorf("after the retry: status %s, targets %v", entry.Status, entry.Targets)
+	}
+}
+
+func TestOutboxRetryRefusesInFlightEntries(t *testing.T) {
+	outbox := newTestOutbox(t)
+	err := &errorid.ErrorWithID{ID: "ERR-20251023-A3F9B2", Original: errors.New("boom")}
+
+	id := outbox.Add("fake", err)
+	if retryErr := outbox.Retry(id); !errors.Is(retryErr, errOutboxInFlight) {
+		t.Fatalf("Retry of an in-flight entry = %v, want %v", retryErr, errOutboxInFlight)
+	}
+
+	outbox.Failed(id, errors.New("down"))
+	if retryErr := outbox.Retry(id); retryErr != nil {
+		t.Fatalf("Retry of a failed attempt = %v", retryErr)
+	}
+	if due := outbox.due(time.Now()); len(due) != 1 {
+		t.Fatalf("%d entries due after Retry, want 1", len(due))
+	}
+	if retryErr := outbox.Retry(id); !errors.Is(retryErr, errOutboxInFlight) {
+		t.Errorf("Retry while redelivering = %v, want %v", retryErr, errOutboxInFlight)
+	}
+
+	outbox.Delivered(id)
+	if retryErr := outbox.Retry(id); !errors.Is(retryErr, errOutboxDelivered) {
+		t.Errorf("Retry of a delivered entry = %v, want %v", retryErr, errOutboxDelivered)
+	}
+	if retryErr := outbox.Retry("fake:missing"); !errors.Is(retryErr, errOutboxNotFound) {
+		t.Errorf("Retry of a missing entry = %v, want %v", retryErr, errOutboxNotFound)
+	}
+}
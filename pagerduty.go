@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+const (
+	defaultPagerDutyEventsURL    = "https://events.pagerduty.com/v2/enqueue"
+	defaultPagerDutyResolveAfter = 30 * time.Minute
+	defaultPagerDutyStateFile    = "pagerduty_incidents.json"
+	pagerDutyMaxSummary          = 1024
+	pagerDutyMaxStackTrace       = 8000
+	// pagerDutyMinInterval stays under the 120 events/minute routing key limit
+	pagerDutyMinInterval = 500 * time.Millisecond
+)
+
+// PagerDutyNotifier triggers PagerDuty incidents through the Events API v2.
+// Every error group (fingerprint) of a service and environment is one alert
+// via dedup_key, and groups that stop occurring are resolved automatically.
+// Open alerts are persisted so they are still resolved after a restart.
+type PagerDutyNotifier struct {
+	routingKey   string
+	sender       *httpSender
+	minSeverity  Severity
+	resolveAfter time.Duration
+	statePath    string
+
+	mu       sync.Mutex
+	open     map[string]time.Time // dedup key -> last occurrence
+	stopChan chan struct{}
+}
+
+// PagerDutyEvent is an Events API v2 event
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Client      string            `json:"client,omitempty"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+}
+
+// PagerDutyPayload describes the triggering error
+type PagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Group         string                 `json:"group,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+// NewPagerDutyNotifier configures PagerDuty from PAGERDUTY_ROUTING_KEY,
+// PAGERDUTY_MIN_SEVERITY (default critical), PAGERDUTY_RESOLVE_AFTER,
+// PAGERDUTY_STATE_FILE and PAGERDUTY_EVENTS_URL. It returns nil when no
+// routing key is set.
+func NewPagerDutyNotifier() *PagerDutyNotifier {
+	routingKey := os.Getenv("PAGERDUTY_ROUTING_KEY")
+	if routingKey == "" {
+		return nil
+	}
+
+	eventsURL := os.Getenv("PAGERDUTY_EVENTS_URL")
+	if eventsURL == "" {
+		eventsURL = defaultPagerDutyEventsURL
+	}
+
+	minSeverity := SeverityCritical
+	if raw := os.Getenv("PAGERDUTY_MIN_SEVERITY"); raw != "" {
+		if severity, ok := ParseSeverity(raw); ok {
+			minSeverity = severity
+		} else {
+			fmt.Fprintf(os.Stderr, "Invalid PAGERDUTY_MIN_SEVERITY=%q, using critical\n", raw)
+		}
+	}
+
+	resolveAfter := defaultPagerDutyResolveAfter
+	if raw := os.Getenv("PAGERDUTY_RESOLVE_AFTER"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+			resolveAfter = d
+		} else {
+			fmt.Fprintf(os.Stderr, "Invalid PAGERDUTY_RESOLVE_AFTER=%q, using %s\n", raw, resolveAfter)
+		}
+	}
+
+	statePath := os.Getenv("PAGERDUTY_STATE_FILE")
+	if statePath == "" {
+		statePath = defaultPagerDutyStateFile
+	} else if statePath == "off" {
+		statePath = ""
+	}
+
+	p := &PagerDutyNotifier{
+		routingKey:   routingKey,
+		sender:       newHTTPSender("PagerDuty", eventsURL, pagerDutyMinInterval),
+		minSeverity:  minSeverity,
+		resolveAfter: resolveAfter,
+		statePath:    statePath,
+		open:         make(map[string]time.Time),
+		stopChan:     make(chan struct{}),
+	}
+	p.loadState()
+
+	// Without a resolve period incidents are only resolved in PagerDuty
+	if resolveAfter > 0 {
+		go p.resolveLoop()
+	}
+	return p
+}
+
+// Name implements Notifier
+func (p *PagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+// Notify triggers (or re-triggers) the alert for err's error group
+func (p *PagerDutyNotifier) Notify(err *errorid.ErrorWithID) error {
+	severity := errorSeverity(err)
+	if severity < p.minSeverity {
+		return nil
+	}
+
+	dedupKey := pagerDutyDedupKey(err)
+	event := PagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    dedupKey,
+		Client:      getServiceName(),
+		Payload:     buildPagerDutyPayload(err, severity),
+	}
+
+	if sendErr := p.send(event); sendErr != nil {
+		return sendErr
+	}
+
+	p.mu.Lock()
+	p.open[dedupKey] = time.Now()
+	p.saveState()
+	p.mu.Unlock()
+	return nil
+}
+
+// pagerDutyDedupKey scopes the error group to the service and environment,
+// so the same error in staging and production, or in two services sharing
+// a routing key, opens separate alerts
+func pagerDutyDedupKey(err *errorid.ErrorWithID) string {
+	return fmt.Sprintf("%s/%s/%s", getServiceName(), getEnvironment(), errorFingerprint(err))
+}
+
+// Close stops the auto-resolve loop; open alerts stay open
+func (p *PagerDutyNotifier) Close(timeout time.Duration) {
+	if p.resolveAfter > 0 {
+		close(p.stopChan)
+	}
+}
+
+// resolveLoop periodically resolves groups quiet for resolveAfter
+func (p *PagerDutyNotifier) resolveLoop() {
+	interval := p.resolveAfter / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.resolveQuiet(time.Now())
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+// resolveQuiet sends resolve events for groups last seen before now-resolveAfter
+func (p *PagerDutyNotifier) resolveQuiet(now time.Time) {
+	var quiet []string
+	p.mu.Lock()
+	for dedupKey, lastSeen := range p.open {
+		if now.Sub(lastSeen) >= p.resolveAfter {
+			quiet = append(quiet, dedupKey)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, dedupKey := range quiet {
+		event := PagerDutyEvent{
+			RoutingKey:  p.routingKey,
+			EventAction: "resolve",
+			DedupKey:    dedupKey,
+		}
+		if err := p.send(event); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to resolve PagerDuty alert %s: %v\n", dedupKey, err)
+			continue
+		}
+
+		// Keep the group open if it occurred again while resolving
+		p.mu.Lock()
+		if now.Sub(p.open[dedupKey]) >= p.resolveAfter {
+			delete(p.open, dedupKey)
+			p.saveState()
+		}
+		p.mu.Unlock()
+	}
+}
+
+// loadState reads the open alerts left by a previous run; a missing file starts empty
+func (p *PagerDutyNotifier) loadState() {
+	if p.statePath == "" {
+		return
+	}
+
+	data, err := os.ReadFile(p.statePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to read PagerDuty state: %v\n", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &p.open); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse PagerDuty state %s: %v\n", p.statePath, err)
+	}
+}
+
+// saveState writes the open alerts atomically; callers must hold p.mu
+func (p *PagerDutyNotifier) saveState() {
+	if p.statePath == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(p.open, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode PagerDuty state: %v\n", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.statePath), ".pagerduty-*")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save PagerDuty state: %v\n", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		fmt.Fprintf(os.Stderr, "Failed to save PagerDuty state: %v\n", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save PagerDuty state: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), p.statePath); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save PagerDuty state: %v\n", err)
+	}
+}
+
+// send posts one event
+func (p *PagerDutyNotifier) send(event PagerDutyEvent) error {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal PagerDuty event: %w", err)
+	}
+	return p.sender.Post(fmt.Sprintf("%s %s", event.EventAction, event.DedupKey), jsonData)
+}
+
+// buildPagerDutyPayload describes err; details become custom_details
+func buildPagerDutyPayload(err *errorid.ErrorWithID, severity Severity) *PagerDutyPayload {
+	meta := getRuntimeMetadata()
+
+	customDetails, _ := sanitizeDetails(err.Details)
+	customDetails["error_id"] = err.ID
+	customDetails["context"] = err.Context
+	customDetails["error"] = errorMessage(err.Original)
+	customDetails["environment"] = getEnvironment()
+	if err.StackTrace != "" {
+		customDetails["stack_trace"] = truncateString(err.StackTrace, pagerDutyMaxStackTrace)
+	}
+
+	return &PagerDutyPayload{
+		Summary:       truncateString(fmt.Sprintf("[%s] %s: %s", getEnvironment(), err.Context, errorMessage(err.Original)), pagerDutyMaxSummary),
+		Source:        meta.Location(),
+		Severity:      severity.String(),
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		Component:     meta.Service,
+		Group:         detailString(err.Details, "category"),
+		Class:         err.Context,
+		CustomDetails: customDetails,
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Correlation headers
+const (
+	requestIDHeader = "X-Request-ID"
+	errorIDHeader   = "X-Error-ID"
+)
+
+// Keys under which the IDs are stored in the Gin context
+const (
+	requestIDKey = "request_id"
+	errorIDKey   = "error_id"
+)
+
+const maxRequestIDLength = 128
+
+// requestIDContextKey stores the request ID in the request's context.Context
+type requestIDContextKey struct{}
+
+// RequestIDMiddleware accepts the caller's X-Request-ID, or generates one,
+// stores it in the Gin and request contexts and echoes it in the response
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDContextKey{}, id))
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestIDFromContext returns the request ID stored by RequestIDMiddleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// validRequestID accepts short IDs made of characters that are safe in
+// headers and log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit hex ID
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// RequestLogger is gin.Logger with the request ID and, for failed requests,
+// the error ID appended, so access lines can be matched to ERR-... IDs
+func RequestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		line := fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | request_id=%v",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			param.Path,
+			param.Keys[requestIDKey],
+		)
+		if errorID, ok := param.Keys[errorIDKey]; ok {
+			line += fmt.Sprintf(" error_id=%v", errorID)
+		}
+		if param.ErrorMessage != "" {
+			line += " | " + param.ErrorMessage
+		}
+		return line + "\n"
+	})
+}
+
+// errorIDWriter holds back error responses (status >= 400) until the
+// handler is done, so the X-Error-ID header can be set from the error_id in
+// the body before anything is sent
+type errorIDWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write buffers error responses and passes everything else through
+func (w *errorIDWriter) Write(data []byte) (int, error) {
+	if w.ResponseWriter.Status() >= 400 && !w.ResponseWriter.Written() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *errorIDWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow holds error responses back along with their body
+func (w *errorIDWriter) WriteHeaderNow() {
+	if w.ResponseWriter.Status() >= 400 {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Written reports buffered error responses as written
+func (w *errorIDWriter) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Size includes buffered bytes
+func (w *errorIDWriter) Size() int {
+	if w.body.Len() > 0 {
+		return w.body.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// flush sets X-Error-ID from the buffered body, if it carries an error_id,
+// and sends the response. It returns the error ID.
+func (w *errorIDWriter) flush() string {
+	if w.ResponseWriter.Status() < 400 || w.ResponseWriter.Written() {
+		return ""
+	}
+
+	var payload struct {
+		ErrorID string `json:"error_id"`
+	}
+	_ = json.Unmarshal(w.body.Bytes(), &payload)
+	if payload.ErrorID != "" {
+		w.ResponseWriter.Header().Set(errorIDHeader, payload.ErrorID)
+	}
+
+	w.ResponseWriter.WriteHeaderNow()
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+	return payload.ErrorID
+}
@@ -39,3 +39,14 @@ func SetupRoutes(router *gin.Engine, handlers *Handlers) {
 		}
 	}
 }
+
+// SetupAdminRoutes configures the token-protected admin endpoints
+func SetupAdminRoutes(router *gin.Engine, admin *AdminHandlers, token string) {
+	adminGroup := router.Group("/admin", AdminAuth(token))
+	{
+		// Notification outbox: list (?status=&notifier=), inspect and retry entries
+		adminGroup.GET("/outbox", admin.ListOutbox)
+		adminGroup.GET("/outbox/:id", admin.GetOutboxEntry)
+		adminGroup.POST("/outbox/:id/retry", admin.RetryOutboxEntry)
+	}
+}
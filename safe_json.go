@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxEncodeDepth limits how deep nested detail values are walked
+const maxEncodeDepth = 10
+
+// jsonSanitizer converts arbitrary values into JSON-safe equivalents and
+// records a warning for every value it had to replace
+type jsonSanitizer struct {
+	warnings []string
+	visiting map[uintptr]bool
+}
+
+// sanitizeDetails sanitizes every value of a details map
+func sanitizeDetails(details map[string]interface{}) (map[string]interface{}, []string) {
+	s := &jsonSanitizer{visiting: make(map[uintptr]bool)}
+	result := make(map[string]interface{}, len(details))
+	for key, value := range details {
+		result[key] = s.sanitize(key, reflect.ValueOf(value), 0)
+	}
+	sort.Strings(s.warnings)
+	return result, s.warnings
+}
+
+// placeholder records a warning and returns the replacement value
+func (s *jsonSanitizer) placeholder(path, reason string) string {
+	s.warnings = append(s.warnings, fmt.Sprintf("%s: %s", path, reason))
+	return fmt.Sprintf("<%s>", reason)
+}
+
+func (s *jsonSanitizer) sanitize(path string, v reflect.Value, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if depth > maxEncodeDepth {
+		return s.placeholder(path, "max depth exceeded")
+	}
+
+	// Pointers, interfaces, maps and slices can form cycles
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Map || (v.Kind() == reflect.Slice && v.Len() > 0) {
+		ptr := v.Pointer()
+		if s.visiting[ptr] {
+			return s.placeholder(path, "cyclic reference")
+		}
+		s.visiting[ptr] = true
+		defer delete(s.visiting, ptr)
+	}
+
+	// Well-known types get a readable representation
+	if v.CanInterface() {
+		switch val := v.Interface().(type) {
+		case time.Time:
+			return val.Format(time.RFC3339)
+		case time.Duration:
+			return val.String()
+		case error:
+			return val.Error()
+		case json.Marshaler:
+			if data, err := val.MarshalJSON(); err == nil && json.Valid(data) {
+				return json.RawMessage(data)
+			}
+			return s.placeholder(path, fmt.Sprintf("unmarshalable %s", v.Type()))
+		case encoding.TextMarshaler:
+			if text, err := val.MarshalText(); err == nil {
+				return string(text)
+			}
+			return s.placeholder(path, fmt.Sprintf("unmarshalable %s", v.Type()))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return s.placeholder(path, fmt.Sprintf("non-finite float %v", f))
+		}
+		return f
+	case reflect.Complex64, reflect.Complex128:
+		return fmt.Sprint(v.Complex())
+	case reflect.String:
+		return v.String()
+	case reflect.Ptr, reflect.Interface:
+		return s.sanitize(path, v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Keep encoding/json's base64 behavior for byte slices
+			if v.Kind() == reflect.Slice {
+				return v.Bytes()
+			}
+		}
+		items := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items[i] = s.sanitize(fmt.Sprintf("%s[%d]", path, i), v.Index(i), depth+1)
+		}
+		return items
+	case reflect.Map:
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			result[key] = s.sanitize(path+"."+key, iter.Value(), depth+1)
+		}
+		return result
+	case reflect.Struct:
+		return s.sanitizeStruct(path, v, depth)
+	default:
+		// chan, func and unsafe.Pointer have no JSON representation
+		return s.placeholder(path, fmt.Sprintf("unsupported %s", v.Type()))
+	}
+}
+
+// sanitizeStruct walks exported struct fields, honoring json tags
+func (s *jsonSanitizer) sanitizeStruct(path string, v reflect.Value, depth int) interface{} {
+	t := v.Type()
+	result := make(map[string]interface{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			tagName, opts, _ := strings.Cut(tag, ",")
+			if tagName == "-" && opts == "" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+			if strings.Contains(opts, "omitempty") && v.Field(i).IsZero() {
+				continue
+			}
+		}
+
+		result[name] = s.sanitize(path+"."+name, v.Field(i), depth+1)
+	}
+	return result
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+const sentryClientName = "go-support-id-example"
+
+// SentryNotifier sends errors as Sentry envelope events to a DSN, so a
+// (self-hosted) Sentry or GlitchTip instance can be used as an error sink.
+// Our error ID stays the primary identifier: it is a tag, the event ID is
+// derived from it, and it leads the event message.
+type SentryNotifier struct {
+	sender    *httpSender
+	dsn       string
+	publicKey string
+}
+
+// SentryEvent is the subset of the Sentry event payload we fill in
+type SentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Platform    string                 `json:"platform"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Message     *SentryMessage         `json:"message,omitempty"`
+	Exception   *SentryExceptions      `json:"exception,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+	Request     *SentryRequest         `json:"request,omitempty"`
+	Fingerprint []string               `json:"fingerprint,omitempty"`
+	Contexts    map[string]interface{} `json:"contexts,omitempty"`
+	SDK         map[string]string      `json:"sdk,omitempty"`
+}
+
+// SentryMessage is the message interface
+type SentryMessage struct {
+	Formatted string `json:"formatted"`
+}
+
+// SentryExceptions is the exception interface
+type SentryExceptions struct {
+	Values []SentryException `json:"values"`
+}
+
+// SentryException is one exception with its stack trace
+type SentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Mechanism  map[string]any    `json:"mechanism,omitempty"`
+	Stacktrace *SentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+// SentryStacktrace holds frames, oldest call first
+type SentryStacktrace struct {
+	Frames []SentryFrame `json:"frames"`
+}
+
+// SentryRequest is the request interface
+type SentryRequest struct {
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// NewSentryNotifier configures the Sentry sink from SENTRY_DSN. It returns
+// nil when SENTRY_DSN is not set.
+func NewSentryNotifier() (*SentryNotifier, error) {
+	dsn := os.Getenv("SENTRY_DSN")
+	if dsn == "" {
+		return nil, nil
+	}
+
+	envelopeURL, publicKey, err := parseSentryDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SentryNotifier{
+		sender:    newHTTPSender("Sentry", envelopeURL, 0),
+		dsn:       dsn,
+		publicKey: publicKey,
+	}
+	return s, nil
+}
+
+// parseSentryDSN turns "https://<key>@<host>[/<path>]/<project>" into the
+// project's envelope endpoint and public key
+func parseSentryDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN: %w", err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN: missing public key")
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	projectID := path[i+1:]
+	if projectID == "" {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN: missing project ID")
+	}
+
+	envelopeURL := fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:i], projectID)
+	return envelopeURL, u.User.Username(), nil
+}
+
+// Name implements Notifier
+func (s *SentryNotifier) Name() string {
+	return "sentry"
+}
+
+// Notify sends err as an envelope with a single event item
+func (s *SentryNotifier) Notify(err *errorid.ErrorWithID) error {
+	event := buildSentryEvent(err)
+	body, encodeErr := s.envelope(event)
+	if encodeErr != nil {
+		return encodeErr
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-sentry-envelope")
+	header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s/%s, sentry_key=%s",
+		sentryClientName, sentryClientVersion(), s.publicKey))
+	return s.sender.PostWithHeaders(err.ID, body, header)
+}
+
+// envelope encodes an event as a Sentry envelope: a header line, an item
+// header line and the event payload
+func (s *SentryNotifier) envelope(event SentryEvent) ([]byte, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Sentry event: %w", err)
+	}
+	envelopeHeader, _ := json.Marshal(map[string]string{
+		"event_id": event.EventID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+		"dsn":      s.dsn,
+	})
+	itemHeader, _ := json.Marshal(map[string]interface{}{
+		"type":   "event",
+		"length": len(payload),
+	})
+
+	var body bytes.Buffer
+	body.Write(envelopeHeader)
+	body.WriteByte('\n')
+	body.Write(itemHeader)
+	body.WriteByte('\n')
+	body.Write(payload)
+	body.WriteByte('\n')
+	return body.Bytes(), nil
+}
+
+// buildSentryEvent translates err into a Sentry event
+func buildSentryEvent(err *errorid.ErrorWithID) SentryEvent {
+	meta := getRuntimeMetadata()
+	severity := errorSeverity(err)
+	details, _ := sanitizeDetails(err.Details)
+
+	tags := map[string]string{
+		"error_id":    err.ID,
+		"environment": getEnvironment(),
+		"severity":    severity.String(),
+	}
+	for _, key := range []string{"category", "http_route", "http_method", "http_status", "request_id"} {
+		if value := detailString(err.Details, key); value != "" {
+			tags[key] = value
+		}
+	}
+
+	exception := SentryException{
+		Type:  fmt.Sprintf("%T", err.Original),
+		Value: errorMessage(err.Original),
+		Mechanism: map[string]any{
+			"type":    "errorid",
+			"handled": !isRecoveredPanic(err.Context),
+		},
+	}
+	if frames := parseGoStackTrace(err.StackTrace); len(frames) > 0 {
+		exception.Stacktrace = &SentryStacktrace{Frames: frames}
+	}
+
+	return SentryEvent{
+		EventID:     sentryEventID(err.ID),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Platform:    "go",
+		Level:       sentryLevel(severity),
+		Logger:      "errorid",
+		ServerName:  meta.Location(),
+		Release:     meta.Version,
+		Environment: getEnvironment(),
+		Message:     &SentryMessage{Formatted: fmt.Sprintf("%s: %s", err.ID, err.Context)},
+		Exception:   &SentryExceptions{Values: []SentryException{exception}},
+		Tags:        tags,
+		Extra:       details,
+		Request:     sentryRequest(err),
+		Fingerprint: []string{errorFingerprint(err)},
+		Contexts: map[string]interface{}{
+			"runtime": map[string]string{"name": "go", "version": meta.GoVersion},
+		},
+		SDK: map[string]string{"name": sentryClientName, "version": sentryClientVersion()},
+	}
+}
+
+// sentryEventID derives the 32-hex-character event ID from our error ID,
+// so resending the same error never creates a second Sentry event
+func sentryEventID(errorID string) string {
+	sum := md5.Sum([]byte(errorID))
+	return hex.EncodeToString(sum[:])
+}
+
+// sentryLevel maps a severity to a Sentry level
+func sentryLevel(severity Severity) string {
+	if severity == SeverityCritical {
+		return "fatal"
+	}
+	return severity.String()
+}
+
+// sentryRequest fills the request interface from request-related details
+func sentryRequest(err *errorid.ErrorWithID) *SentryRequest {
+	request := &SentryRequest{
+		Method: detailString(err.Details, "http_method"),
+		URL:    detailString(err.Details, "http_route"),
+	}
+	if userAgent := detailString(err.Details, "user_agent"); userAgent != "" {
+		request.Headers = map[string]string{"User-Agent": userAgent}
+	}
+	if ip := detailString(err.Details, "ip_address"); ip != "" {
+		request.Env = map[string]string{"REMOTE_ADDR": ip}
+	}
+
+	if request.Method == "" && request.URL == "" && request.Headers == nil && request.Env == nil {
+		return nil
+	}
+	return request
+}
+
+// sentryClientVersion is the version reported in the SDK info
+func sentryClientVersion() string {
+	if version := getRuntimeMetadata().Version; version != "" {
+		return version
+	}
+	return "dev"
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// mainModulePath is the module path of this service, e.g.
+// "go-support-id-example"; frames from its packages are in-app
+var mainModulePath = func() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Path
+	}
+	return ""
+}()
+
+// SentryFrame is one frame of a Sentry stack trace
+type SentryFrame struct {
+	Function string `json:"function,omitempty"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	AbsPath  string `json:"abs_path,omitempty"`
+	Lineno   int    `json:"lineno,omitempty"`
+	InApp    bool   `json:"in_app"`
+}
+
+// parseGoStackTrace parses a debug.Stack()-style trace of the first
+// goroutine into Sentry frames, ordered oldest call first as Sentry expects
+//
+//	goroutine 1 [running]:
+//	main.(*Handlers).HandlePanic(0xc000010000)
+//		/app/handlers.go:120 +0x1d
+func parseGoStackTrace(trace string) []SentryFrame {
+	lines := strings.Split(strings.ReplaceAll(trace, "\r\n", "\n"), "\n")
+
+	var frames []SentryFrame
+	seenGoroutine := false
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "goroutine ") {
+			// Only the goroutine that produced the error is relevant
+			if seenGoroutine {
+				break
+			}
+			seenGoroutine = true
+			continue
+		}
+		if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "\t") {
+			continue
+		}
+
+		frame := parseStackFrame(line, strings.TrimSpace(lines[i+1]))
+		frames = append(frames, frame)
+		i++
+	}
+
+	// Go prints the innermost call first; Sentry wants it last
+	for left, right := 0, len(frames)-1; left < right; left, right = left+1, right-1 {
+		frames[left], frames[right] = frames[right], frames[left]
+	}
+	return frames
+}
+
+// parseStackFrame builds a frame from a function line and its location line
+func parseStackFrame(functionLine, locationLine string) SentryFrame {
+	function := strings.TrimPrefix(functionLine, "created by ")
+	if i := strings.Index(function, " in goroutine "); i >= 0 {
+		function = function[:i]
+	}
+	if strings.HasSuffix(function, ")") {
+		if i := strings.LastIndex(function, "("); i > 0 {
+			function = function[:i]
+		}
+	}
+	module, name := splitGoFunction(function)
+
+	// "/app/handlers.go:120 +0x1d"
+	location := locationLine
+	if i := strings.LastIndex(location, " +0x"); i >= 0 {
+		location = location[:i]
+	}
+	absPath, lineno := location, 0
+	if i := strings.LastIndex(location, ":"); i >= 0 {
+		if n, err := strconv.Atoi(location[i+1:]); err == nil {
+			absPath, lineno = location[:i], n
+		}
+	}
+
+	filename := absPath
+	if i := strings.LastIndex(absPath, "/"); i >= 0 {
+		filename = absPath[i+1:]
+	}
+
+	return SentryFrame{
+		Function: name,
+		Module:   module,
+		Filename: filename,
+		AbsPath:  absPath,
+		Lineno:   lineno,
+		InApp:    isInAppFrame(module, absPath),
+	}
+}
+
+// splitGoFunction splits "github.com/a/b.(*T).M" into package
+// "github.com/a/b" and function "(*T).M"
+func splitGoFunction(function string) (string, string) {
+	start := strings.LastIndex(function, "/") + 1
+	if i := strings.Index(function[start:], "."); i >= 0 {
+		return function[:start+i], function[start+i+1:]
+	}
+	return "", function
+}
+
+// isInAppFrame reports whether a frame belongs to this service rather than
+// the Go runtime, the standard library or a module dependency. It goes by
+// the package path, since file paths are rewritten by -trimpath.
+func isInAppFrame(module, absPath string) bool {
+	if strings.Contains(absPath, "/pkg/mod/") {
+		return false
+	}
+	// Without build info only package main is known to be ours
+	return module == "main" || hasPathPrefix(module, mainModulePath)
+}
+
+// hasPathPrefix reports whether pkg is prefix or a package below it
+func hasPathPrefix(pkg, prefix string) bool {
+	return prefix != "" && (pkg == prefix || strings.HasPrefix(pkg, prefix+"/"))
+}
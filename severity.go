@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// Severity ranks how urgent an error is
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+	SeverityCritical
+)
+
+// categorySeverity is the default severity per error category (error type)
+var categorySeverity = map[string]Severity{
+	"validation": SeverityWarning,
+	"auth":       SeverityWarning,
+	"network":    SeverityError,
+	"payment":    SeverityError,
+	"database":   SeverityCritical,
+}
+
+// String returns the lowercase name used in ELK "level" and config files
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "error"
+	}
+}
+
+// DiscordColor returns the embed color for the severity
+func (s Severity) DiscordColor() int {
+	switch s {
+	case SeverityInfo:
+		return 3447003 // Blue
+	case SeverityWarning:
+		return 16776960 // Yellow
+	case SeverityCritical:
+		return 10038562 // Dark red
+	default:
+		return 15158332 // Red
+	}
+}
+
+// ParseSeverity parses a severity name ("warn" is accepted for "warning")
+func ParseSeverity(s string) (Severity, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "info":
+		return SeverityInfo, true
+	case "warning", "warn":
+		return SeverityWarning, true
+	case "error":
+		return SeverityError, true
+	case "critical", "fatal":
+		return SeverityCritical, true
+	}
+	return SeverityError, false
+}
+
+// panicRecoveredContext is the context errorid.RecoveryMiddleware and
+// recoverWithRequestDetails give errors built from a recovered panic
+const panicRecoveredContext = "panic recovered in HTTP handler"
+
+// isRecoveredPanic reports whether an error was built by the recovery
+// middleware from a panic rather than returned by a handler
+func isRecoveredPanic(context string) bool {
+	return context == panicRecoveredContext
+}
+
+// errorSeverity classifies a tracked error
+func errorSeverity(err *errorid.ErrorWithID) Severity {
+	return classifySeverity(err.Context, err.Details)
+}
+
+// classifySeverity derives a severity, in order of precedence, from an
+// explicit "severity" detail, a recovered panic, a known "category" detail
+// and the "http_status" detail. Anything else is an error.
+func classifySeverity(context string, details map[string]interface{}) Severity {
+	if hint := detailString(details, "severity"); hint != "" {
+		if severity, ok := ParseSeverity(hint); ok {
+			return severity
+		}
+	}
+
+	if isRecoveredPanic(context) {
+		return SeverityCritical
+	}
+
+	if severity, ok := categorySeverity[strings.ToLower(detailString(details, "category"))]; ok {
+		return severity
+	}
+
+	if status, err := strconv.Atoi(detailString(details, "http_status")); err == nil {
+		switch {
+		case status >= 500:
+			return SeverityError
+		case status >= 400:
+			return SeverityWarning
+		default:
+			return SeverityInfo
+		}
+	}
+
+	return SeverityError
+}
+
+// severitySampler keeps a fraction of notifications per severity
+type severitySampler struct {
+	rates map[Severity]float64
+}
+
+// loadSeveritySampler reads rates such as "info=0.1,warning=0.5" from the
+// named environment variable. Unlisted severities are always kept, and
+// critical errors are never sampled away.
+func loadSeveritySampler(name string) *severitySampler {
+	sampler := &severitySampler{rates: make(map[Severity]float64)}
+
+	for _, pair := range strings.Split(os.Getenv(name), ",") {
+		level, raw, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		severity, validLevel := ParseSeverity(level)
+		rate, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if !validLevel || err != nil || rate < 0 || rate > 1 {
+			fmt.Fprintf(os.Stderr, "Invalid %s entry %q\n", name, pair)
+			continue
+		}
+		if severity != SeverityCritical {
+			sampler.rates[severity] = rate
+		}
+	}
+
+	return sampler
+}
+
+// Keep reports whether a notification of the given severity should be sent
+func (s *severitySampler) Keep(severity Severity) bool {
+	rate, ok := s.rates[severity]
+	if !ok {
+		return true
+	}
+	return rand.Float64() < rate
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// Slack Block Kit limits, counted in characters
+// (https://api.slack.com/reference/block-kit/blocks)
+const (
+	slackMaxHeaderText  = 150
+	slackMaxSectionText = 3000
+	slackMaxFieldText   = 2000
+	slackMaxFallback    = 4000
+	slackStackPreview   = 1500
+	// slackMaxErrorText keeps the error and context together in one section
+	slackMaxErrorText = 1400
+	// slackMaxDetailValue keeps one long detail from crowding out the rest
+	slackMaxDetailValue = 300
+)
+
+// slackMinInterval keeps an incoming webhook at about one message per second
+const slackMinInterval = time.Second
+
+// SlackWebhook sends error notifications to a Slack incoming webhook
+type SlackWebhook struct {
+	sender  *httpSender
+	sampler *severitySampler
+}
+
+// SlackMessage is an incoming webhook payload. Text is the notification
+// fallback; the blocks sit in an attachment so they get a severity color bar.
+type SlackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+}
+
+// SlackAttachment carries the Block Kit blocks and the color bar
+type SlackAttachment struct {
+	Color  string       `json:"color,omitempty"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+// SlackBlock is a Block Kit header, section or context block
+type SlackBlock struct {
+	Type     string      `json:"type"`
+	Text     *SlackText  `json:"text,omitempty"`
+	Fields   []SlackText `json:"fields,omitempty"`
+	Elements []SlackText `json:"elements,omitempty"`
+}
+
+// SlackText is a plain_text or mrkdwn text object
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// NewSlackWebhook creates a Slack notifier.
+// It returns nil when webhookURL is empty, so Slack stays disabled.
+func NewSlackWebhook(webhookURL string) *SlackWebhook {
+	if webhookURL == "" {
+		return nil
+	}
+
+	return &SlackWebhook{
+		sender:  newHTTPSender("Slack", webhookURL, slackMinInterval),
+		sampler: loadSeveritySampler("SLACK_SAMPLE_RATES"),
+	}
+}
+
+// Name implements Notifier
+func (s *SlackWebhook) Name() string {
+	return "slack"
+}
+
+// Notify posts a Block Kit notification for err
+func (s *SlackWebhook) Notify(err *errorid.ErrorWithID) error {
+	if !s.sampler.Keep(errorSeverity(err)) {
+		return nil
+	}
+	return s.send(err)
+}
+
+// NotifyDelivery implements deliveryNotifier; outbox replays are not sampled again
+func (s *SlackWebhook) NotifyDelivery(err *errorid.ErrorWithID, delivery Delivery, done func(error)) {
+	if delivery.Replay {
+		done(s.send(err))
+		return
+	}
+	done(s.Notify(err))
+}
+
+// send posts err
+func (s *SlackWebhook) send(err *errorid.ErrorWithID) error {
+	jsonData, marshalErr := json.Marshal(buildSlackMessage(err))
+	if marshalErr != nil {
+		return fmt.Errorf("failed to marshal Slack message: %w", marshalErr)
+	}
+	return s.sender.Post(err.ID, jsonData)
+}
+
+// buildSlackMessage renders an error with Block Kit, within Slack's limits
+func buildSlackMessage(err *errorid.ErrorWithID) SlackMessage {
+	severity := errorSeverity(err)
+	meta := getRuntimeMetadata()
+
+	blocks := []SlackBlock{
+		{
+			Type: "header",
+			Text: &SlackText{Type: "plain_text", Text: truncateString(fmt.Sprintf("🚨 Error: %s", err.ID), slackMaxHeaderText)},
+		},
+		slackSection(fmt.Sprintf("*Error:* %s\n*Context:* %s",
+			escapeSlackLimit(errorMessage(err.Original), slackMaxErrorText),
+			escapeSlackLimit(err.Context, slackMaxErrorText))),
+	}
+
+	fields := []SlackText{
+		slackField("Severity", strings.ToUpper(severity.String())),
+		slackField("Environment", getEnvironment()),
+		slackField("Host", meta.Location()),
+	}
+	blocks = append(blocks, SlackBlock{Type: "section", Fields: fields})
+
+	if len(err.Details) > 0 {
+		const title = "*Details*\n"
+		blocks = append(blocks, slackSection(title+formatSlackDetails(err.Details, slackMaxSectionText-len(title))))
+	}
+
+	if err.StackTrace != "" {
+		blocks = append(blocks, slackSection("*Stack Trace (preview)*\n"+slackCodeBlock(err.StackTrace, slackStackPreview)))
+	}
+
+	blocks = append(blocks, SlackBlock{
+		Type: "context",
+		Elements: []SlackText{
+			{Type: "mrkdwn", Text: escapeSlack(fmt.Sprintf("%s • fingerprint %s", meta.BuildLabel(), errorFingerprint(err)))},
+		},
+	})
+
+	return SlackMessage{
+		Text: truncateString(fmt.Sprintf("Error %s: %s: %s", err.ID, err.Context, errorMessage(err.Original)), slackMaxFallback),
+		Attachments: []SlackAttachment{
+			{Color: fmt.Sprintf("#%06x", severity.DiscordColor()), Blocks: blocks},
+		},
+	}
+}
+
+// slackSection builds a mrkdwn section block; callers keep text within
+// slackMaxSectionText by limiting each part as they escape it
+func slackSection(text string) SlackBlock {
+	return SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: text}}
+}
+
+// slackField builds a "*name*\nvalue" section field
+func slackField(name, value string) SlackText {
+	return SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%s", name, escapeSlackLimit(value, slackMaxFieldText-len(name)-3))}
+}
+
+// formatSlackDetails lists details sorted by key in at most maxLen
+// characters, noting when some had to be left out
+func formatSlackDetails(details map[string]interface{}, maxLen int) string {
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	const omitted = "_More details omitted_\n"
+	var result strings.Builder
+	length := 0
+	for _, key := range keys {
+		line := fmt.Sprintf("• *%s*: %s\n", escapeSlackLimit(key, slackMaxDetailValue), escapeSlackLimit(fmt.Sprint(details[key]), slackMaxDetailValue))
+		n := utf8.RuneCountInString(line)
+		if length+n > maxLen-len(omitted) {
+			result.WriteString(omitted)
+			break
+		}
+		result.WriteString(line)
+		length += n
+	}
+	return result.String()
+}
+
+// slackEscaper escapes the three characters Slack's mrkdwn treats as control characters
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeSlack makes arbitrary text safe for mrkdwn (no links or @channel pings)
+func escapeSlack(s string) string {
+	return slackEscaper.Replace(s)
+}
+
+// escapeSlackLimit escapes s within maxLen characters without splitting an
+// entity such as "&amp;"
+func escapeSlackLimit(s string, maxLen int) string {
+	return escapeLimit(s, maxLen, escapeSlack)
+}
+
+// slackCodeBlock wraps s in a code block of at most maxLen characters
+func slackCodeBlock(s string, maxLen int) string {
+	const fence = "```"
+	s = strings.ReplaceAll(s, "``", "`\u200b`")
+	return fence + "\n" + escapeSlackLimit(s, maxLen-len(fence)*2-2) + "\n" + fence
+}
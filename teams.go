@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+const (
+	// defaultTeamsMaxPayloadBytes stays below the ~28 KB Teams accepts per message
+	defaultTeamsMaxPayloadBytes = 28000
+	teamsStackPreview           = 8000
+	teamsMaxMessage             = 4000
+	teamsMaxFactValue           = 500
+	// teamsMinInterval stays under the 4 requests/second webhook limit
+	teamsMinInterval = 250 * time.Millisecond
+)
+
+// TeamsWebhook sends error notifications as Adaptive Cards to a Teams
+// incoming webhook or a Power Automate Workflows webhook
+type TeamsWebhook struct {
+	sender          *httpSender
+	sampler         *severitySampler
+	maxPayloadBytes int
+}
+
+// TeamsMessage is the webhook payload wrapping one Adaptive Card
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+// TeamsAttachment holds the card
+type TeamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	ContentURL  *string      `json:"contentUrl"`
+	Content     AdaptiveCard `json:"content"`
+}
+
+// AdaptiveCard is the subset of the Adaptive Card schema used for errors
+type AdaptiveCard struct {
+	Schema  string                 `json:"$schema"`
+	Type    string                 `json:"type"`
+	Version string                 `json:"version"`
+	Body    []CardElement          `json:"body"`
+	Actions []CardAction           `json:"actions,omitempty"`
+	MSTeams map[string]interface{} `json:"msteams,omitempty"`
+}
+
+// CardElement is a TextBlock, FactSet or Container
+type CardElement struct {
+	Type      string        `json:"type"`
+	ID        string        `json:"id,omitempty"`
+	Text      string        `json:"text,omitempty"`
+	Weight    string        `json:"weight,omitempty"`
+	Size      string        `json:"size,omitempty"`
+	Color     string        `json:"color,omitempty"`
+	FontType  string        `json:"fontType,omitempty"`
+	Wrap      bool          `json:"wrap,omitempty"`
+	IsSubtle  bool          `json:"isSubtle,omitempty"`
+	IsVisible *bool         `json:"isVisible,omitempty"`
+	Facts     []CardFact    `json:"facts,omitempty"`
+	Items     []CardElement `json:"items,omitempty"`
+}
+
+// CardFact is one row of a FactSet
+type CardFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// CardAction is a card action; only Action.ToggleVisibility is used
+type CardAction struct {
+	Type           string   `json:"type"`
+	Title          string   `json:"title"`
+	TargetElements []string `json:"targetElements,omitempty"`
+}
+
+// NewTeamsWebhook creates a Teams notifier.
+// It returns nil when webhookURL is empty, so Teams stays disabled.
+func NewTeamsWebhook(webhookURL string) *TeamsWebhook {
+	if webhookURL == "" {
+		return nil
+	}
+
+	return &TeamsWebhook{
+		sender:          newHTTPSender("Teams", webhookURL, teamsMinInterval),
+		sampler:         loadSeveritySampler("TEAMS_SAMPLE_RATES"),
+		maxPayloadBytes: envInt("TEAMS_MAX_PAYLOAD_BYTES", defaultTeamsMaxPayloadBytes),
+	}
+}
+
+// Name implements Notifier
+func (t *TeamsWebhook) Name() string {
+	return "teams"
+}
+
+// Notify posts an Adaptive Card notification for err
+func (t *TeamsWebhook) Notify(err *errorid.ErrorWithID) error {
+	if !t.sampler.Keep(errorSeverity(err)) {
+		return nil
+	}
+	return t.send(err)
+}
+
+// NotifyDelivery implements deliveryNotifier; outbox replays are not sampled again
+func (t *TeamsWebhook) NotifyDelivery(err *errorid.ErrorWithID, delivery Delivery, done func(error)) {
+	if delivery.Replay {
+		done(t.send(err))
+		return
+	}
+	done(t.Notify(err))
+}
+
+// send posts err
+func (t *TeamsWebhook) send(err *errorid.ErrorWithID) error {
+	jsonData, encodeErr := encodeTeamsMessage(err, t.maxPayloadBytes)
+	if encodeErr != nil {
+		return fmt.Errorf("failed to encode Teams message: %w", encodeErr)
+	}
+	return t.sender.Post(err.ID, jsonData)
+}
+
+// encodeTeamsMessage renders err and shrinks the card until it fits in
+// maxBytes: first the stack trace is shortened and removed, then detail
+// facts are dropped, then the error message is truncated. It returns an
+// error when even the smallest card is too large.
+func encodeTeamsMessage(err *errorid.ErrorWithID, maxBytes int) ([]byte, error) {
+	details := teamsDetailFacts(err.Details)
+	stackLimit := teamsStackPreview
+	messageLimit := teamsMaxMessage
+
+	for {
+		message := buildTeamsMessage(err, details, stackLimit, messageLimit)
+		jsonData, marshalErr := json.Marshal(message)
+		if marshalErr != nil || len(jsonData) <= maxBytes {
+			return jsonData, marshalErr
+		}
+
+		switch {
+		case stackLimit > 0 && err.StackTrace != "":
+			stackLimit /= 2
+			if stackLimit < 200 {
+				stackLimit = 0
+			}
+		case len(details) > 0:
+			details = details[:len(details)-1]
+		case messageLimit > 100:
+			messageLimit /= 2
+		default:
+			return nil, fmt.Errorf("card is %d bytes after shrinking, over the %d byte limit", len(jsonData), maxBytes)
+		}
+	}
+}
+
+// buildTeamsMessage renders err as an Adaptive Card with a facts table and
+// a stack trace hidden behind a "Show stack trace" toggle
+func buildTeamsMessage(err *errorid.ErrorWithID, details []CardFact, stackLimit, messageLimit int) TeamsMessage {
+	severity := errorSeverity(err)
+	meta := getRuntimeMetadata()
+
+	body := []CardElement{
+		{
+			Type:   "TextBlock",
+			Text:   fmt.Sprintf("🚨 Error: %s", err.ID),
+			Weight: "Bolder",
+			Size:   "Medium",
+			Color:  teamsColor(severity),
+			Wrap:   true,
+		},
+		{
+			Type: "TextBlock",
+			Text: escapeTeamsLimit(errorMessage(err.Original), messageLimit),
+			Wrap: true,
+		},
+		{
+			Type: "FactSet",
+			Facts: []CardFact{
+				{Title: "Error ID", Value: escapeTeamsMarkdown(err.ID)},
+				{Title: "Context", Value: escapeTeamsLimit(err.Context, teamsMaxFactValue)},
+				{Title: "Severity", Value: strings.ToUpper(severity.String())},
+				{Title: "Environment", Value: escapeTeamsMarkdown(getEnvironment())},
+				{Title: "Host", Value: escapeTeamsMarkdown(meta.Location())},
+			},
+		},
+	}
+
+	if len(details) > 0 {
+		body = append(body,
+			CardElement{Type: "TextBlock", Text: "Details", Weight: "Bolder", Wrap: true},
+			CardElement{Type: "FactSet", Facts: details},
+		)
+	}
+
+	var actions []CardAction
+	if err.StackTrace != "" && stackLimit > 0 {
+		hidden := false
+		body = append(body, CardElement{
+			Type:      "Container",
+			ID:        "stack-trace",
+			IsVisible: &hidden,
+			Items: []CardElement{
+				{Type: "TextBlock", Text: escapeTeamsLimit(err.StackTrace, stackLimit), FontType: "Monospace", Size: "Small", Wrap: true},
+			},
+		})
+		actions = append(actions, CardAction{Type: "Action.ToggleVisibility", Title: "Show stack trace", TargetElements: []string{"stack-trace"}})
+	}
+
+	body = append(body, CardElement{Type: "TextBlock", Text: escapeTeamsMarkdown(meta.BuildLabel()), Size: "Small", IsSubtle: true, Wrap: true})
+
+	return TeamsMessage{
+		Type: "message",
+		Attachments: []TeamsAttachment{
+			{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content: AdaptiveCard{
+					Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+					Type:    "AdaptiveCard",
+					Version: "1.4",
+					Body:    body,
+					Actions: actions,
+					MSTeams: map[string]interface{}{"width": "Full"},
+				},
+			},
+		},
+	}
+}
+
+// teamsDetailFacts converts details to facts sorted by key
+func teamsDetailFacts(details map[string]interface{}) []CardFact {
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	facts := make([]CardFact, 0, len(keys))
+	for _, key := range keys {
+		facts = append(facts, CardFact{
+			Title: escapeTeamsMarkdown(key),
+			Value: escapeTeamsLimit(fmt.Sprint(details[key]), teamsMaxFactValue),
+		})
+	}
+	return facts
+}
+
+// teamsMarkdownEscaper backslash-escapes the inline markdown Teams renders
+// in TextBlocks and facts
+var teamsMarkdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"_", `\_`,
+	"~", `\~`,
+	"`", "\\`",
+	"[", `\[`,
+	"]", `\]`,
+)
+
+// teamsBlockMarker matches list, quote and heading markers at line starts
+var teamsBlockMarker = regexp.MustCompile(`(?m)^([ \t]*)([-+>#]|\d+\.)`)
+
+// escapeTeamsMarkdown makes arbitrary error text render literally in cards
+func escapeTeamsMarkdown(s string) string {
+	s = teamsMarkdownEscaper.Replace(s)
+	return teamsBlockMarker.ReplaceAllStringFunc(s, func(marker string) string {
+		trimmed := strings.TrimLeft(marker, " \t")
+		indent := marker[:len(marker)-len(trimmed)]
+		if strings.HasSuffix(trimmed, ".") {
+			return indent + strings.TrimSuffix(trimmed, ".") + `\.`
+		}
+		return indent + `\` + trimmed
+	})
+}
+
+// escapeTeamsLimit escapes s within maxLen characters; the raw text is
+// cut, so the escaped value never exceeds the limit or ends mid-escape
+func escapeTeamsLimit(s string, maxLen int) string {
+	return escapeLimit(s, maxLen, escapeTeamsMarkdown)
+}
+
+// teamsColor maps a severity to an Adaptive Card text color
+func teamsColor(severity Severity) string {
+	switch severity {
+	case SeverityInfo:
+		return "Accent"
+	case SeverityWarning:
+		return "Warning"
+	default:
+		return "Attention"
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+func TestTeamsMessageGolden(t *testing.T) {
+	useFixedRuntimeMetadata(t)
+	t.Setenv("ENVIRONMENT", "production")
+
+	tests := []struct {
+		name     string
+		err      *errorid.ErrorWithID
+		maxBytes int
+	}{
+		{
+			name: "teams/database_error",
+			err: &errorid.ErrorWithID{
+				ID:       "ERR-20251023-A3F9B2",
+				Original: errors.New("connection to database timed out after 30s"),
+				Context:  "failed to connect to PostgreSQL",
+				Details: map[string]interface{}{
+					"category":    "database",
+					"http_status": 503,
+					"request_id":  "req-123",
+				},
+				StackTrace: "goroutine 1 [running]:\nmain.(*DatabaseService).Connect()\n\t/app/services.go:19 +0x1d",
+			},
+			maxBytes: defaultTeamsMaxPayloadBytes,
+		},
+		{
+			name: "teams/markdown_escaping",
+			err: &errorid.ErrorWithID{
+				ID:       "ERR-20251023-B4C5D6",
+				Original: errors.New("*bold* _italic_ `code` ~~strike~~ [click](https://example.com)"),
+				Context:  "# heading\n- item\n1. first\n> quote",
+				Details: map[string]interface{}{
+					"user_*agent*": `C:\path\to\file`,
+				},
+				StackTrace: "panic: *runtime.Error*\n\tmain.handler()",
+			},
+			maxBytes: defaultTeamsMaxPayloadBytes,
+		},
+		{
+			name: "teams/shrunk",
+			err: &errorid.ErrorWithID{
+				ID:       "ERR-20251023-C7D8E9",
+				Original: errors.New(strings.Repeat("é", 5000)),
+				Context:  "oversized error",
+				Details: map[string]interface{}{
+					"payload": strings.Repeat("x", 2000),
+					"query":   strings.Repeat("y", 2000),
+				},
+				StackTrace: strings.Repeat("main.handler()\n\t/app/handlers.go:42\n", 500),
+			},
+			maxBytes: 3000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonData, err := encodeTeamsMessage(tt.err, tt.maxBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jsonData) > tt.maxBytes {
+				t.Errorf("card is %d bytes, limit %d", len(jsonData), tt.maxBytes)
+			}
+			assertGolden(t, tt.name, json.RawMessage(jsonData))
+		})
+	}
+}
+
+func TestEncodeTeamsMessageRejectsOversizedCard(t *testing.T) {
+	useFixedRuntimeMetadata(t)
+	err := &errorid.ErrorWithID{
+		ID:       "ERR-20251023-D1E2F3",
+		Original: errors.New("boom"),
+		Context:  strings.Repeat("c", teamsMaxFactValue),
+	}
+
+	if jsonData, encodeErr := encodeTeamsMessage(err, 500); encodeErr == nil {
+		t.Fatalf("got a %d byte card, want an error", len(jsonData))
+	}
+}
+
+func TestEscapeTeamsMarkdown(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "plain text", want: "plain text"},
+		{in: "*bold* _it_", want: `\*bold\* \_it\_`},
+		{in: "[link](url)", want: `\[link\](url)`},
+		{in: "- item\n  + nested", want: "\\- item\n  \\+ nested"},
+		{in: "1. first\n# title", want: "1\\. first\n\\# title"},
+		{in: "a - b", want: "a - b"},
+		{in: `C:\dir`, want: `C:\\dir`},
+	}
+	for _, tt := range tests {
+		if got := escapeTeamsMarkdown(tt.in); got != tt.want {
+			t.Errorf("escapeTeamsMarkdown(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTeamsFactsStayWithinLimitAfterEscaping(t *testing.T) {
+	facts := teamsDetailFacts(map[string]interface{}{"query": strings.Repeat("*", teamsMaxFactValue)})
+	value := facts[0].Value
+	if n := utf8.RuneCountInString(value); n > teamsMaxFactValue {
+		t.Errorf("escaped fact value has %d characters, limit %d", n, teamsMaxFactValue)
+	}
+	if !strings.HasSuffix(value, `\*...`) {
+		t.Errorf("fact value %q...%q is not cut between escapes", value[:10], value[len(value)-10:])
+	}
+}
+
+func TestTeamsWebhookNotify(t *testing.T) {
+	useFixedRuntimeMetadata(t)
+	server := newFakeDiscord(t)
+	teams := NewTeamsWebhook(server.URL)
+	teams.sender.httpClient = server.Client()
+
+	err := &errorid.ErrorWithID{
+		ID:       "ERR-20251023-A3F9B2",
+		Original: errors.New("connection refused"),
+		Context:  "failed to call payment gateway",
+	}
+	if notifyErr := teams.Notify(err); notifyErr != nil {
+		t.Fatal(notifyErr)
+	}
+
+	bodies := server.received()
+	if len(bodies) != 1 {
+		t.Fatalf("webhook received %d requests, want 1", len(bodies))
+	}
+	var message TeamsMessage
+	if decodeErr := json.Unmarshal([]byte(bodies[0]), &message); decodeErr != nil {
+		t.Fatalf("invalid card: %v", decodeErr)
+	}
+	if len(message.Attachments) != 1 || !strings.Contains(bodies[0], err.ID) {
+		t.Errorf("unexpected card: %s", bodies[0])
+	}
+}
+
+func TestTeamsWebhookNotifyReportsClientErrors(t *testing.T) {
+	useFixedRuntimeMetadata(t)
+	server := newFakeDiscord(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Summary or Text is required.")
+	})
+	teams := NewTeamsWebhook(server.URL)
+	teams.sender.httpClient = server.Client()
+
+	err := &errorid.ErrorWithID{ID: "ERR-20251023-A3F9B2", Original: errors.New("boom")}
+	notifyErr := teams.Notify(err)
+	if notifyErr == nil || !strings.Contains(notifyErr.Error(), "400") {
+		t.Fatalf("got %v, want the 400 reported", notifyErr)
+	}
+	if got := len(server.received()); got != 1 {
+		t.Errorf("webhook received %d requests, want no retry of a 400", got)
+	}
+}
+
+func TestTeamsWebhookNotifyRejectsOversizedCard(t *testing.T) {
+	useFixedRuntimeMetadata(t)
+	server := newFakeDiscord(t)
+	teams := NewTeamsWebhook(server.URL)
+	teams.sender.httpClient = server.Client()
+	teams.maxPayloadBytes = 200
+
+	err := &errorid.ErrorWithID{ID: "ERR-20251023-A3F9B2", Original: errors.New("boom")}
+	if notifyErr := teams.Notify(err); notifyErr == nil {
+		t.Fatal("oversized card was sent")
+	}
+	if got := len(server.received()); got != 0 {
+		t.Errorf("webhook received %d requests, want none", got)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// Telegram Bot API limits
+const (
+	telegramMaxMessage      = 4096
+	telegramMaxCaption      = 1024
+	telegramMaxErrorText    = 1000
+	telegramMaxDetailValue  = 300
+	telegramMaxMetaText     = 200
+	telegramDefaultAPIURL   = "https://api.telegram.org"
+	telegramMinInterval     = time.Second / 30
+	telegramMarkdownSpecial = "_*[]()~`>#+-=|{}.!\\"
+)
+
+// TelegramRoute sends errors matching Match to the listed chats
+type TelegramRoute struct {
+	Name    string     `json:"name"`
+	Match   ErrorMatch `json:"match"`
+	ChatIDs []string   `json:"chat_ids"`
+	// Continue keeps evaluating later routes after this one matched
+	Continue bool `json:"continue,omitempty"`
+}
+
+// TelegramRoutingConfig is the content of TELEGRAM_ROUTES_FILE
+type TelegramRoutingConfig struct {
+	// Default chats receive errors no route matched
+	Default []string        `json:"default"`
+	Routes  []TelegramRoute `json:"routes"`
+}
+
+// TelegramNotifier sends MarkdownV2 error alerts through a Telegram bot.
+// Stack traces too long for the message are uploaded as a document.
+type TelegramNotifier struct {
+	messages  *httpSender
+	documents *httpSender
+	routes    TelegramRoutingConfig
+}
+
+// telegramMessage is the sendMessage request body
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+// NewTelegramNotifier configures Telegram alerts from TELEGRAM_BOT_TOKEN,
+// TELEGRAM_CHAT_IDS and TELEGRAM_ROUTES_FILE. It returns nil when
+// TELEGRAM_BOT_TOKEN is not set.
+func NewTelegramNotifier() (*TelegramNotifier, error) {
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return nil, nil
+	}
+
+	routes, err := loadTelegramRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	apiURL := strings.TrimSuffix(os.Getenv("TELEGRAM_API_URL"), "/")
+	if apiURL == "" {
+		apiURL = telegramDefaultAPIURL
+	}
+	botURL := fmt.Sprintf("%s/bot%s", apiURL, token)
+
+	return &TelegramNotifier{
+		messages:  newHTTPSender("Telegram", botURL+"/sendMessage", telegramMinInterval),
+		documents: newHTTPSender("Telegram", botURL+"/sendDocument", telegramMinInterval),
+		routes:    routes,
+	}, nil
+}
+
+// loadTelegramRoutes reads TELEGRAM_ROUTES_FILE; TELEGRAM_CHAT_IDS
+// (comma-separated) is the default chat list when the file has none. Chat
+// IDs may reference environment variables, as Discord webhooks can.
+func loadTelegramRoutes() (TelegramRoutingConfig, error) {
+	var config TelegramRoutingConfig
+	if path := os.Getenv("TELEGRAM_ROUTES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to read Telegram routes file: %w", err)
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, fmt.Errorf("failed to parse Telegram routes file %s: %w", path, err)
+		}
+	}
+
+	config.Default = expandEnvList(config.Default)
+	if len(config.Default) == 0 {
+		config.Default = expandEnvList(strings.Split(os.Getenv("TELEGRAM_CHAT_IDS"), ","))
+	}
+	for i := range config.Routes {
+		route := &config.Routes[i]
+		route.ChatIDs = expandEnvList(route.ChatIDs)
+		if len(route.ChatIDs) == 0 {
+			fmt.Fprintf(os.Stderr, "Telegram route %q has no chat IDs configured\n", route.Name)
+		}
+	}
+	if len(config.Default) == 0 && len(config.Routes) == 0 {
+		return config, fmt.Errorf("TELEGRAM_CHAT_IDS or TELEGRAM_ROUTES_FILE is required for Telegram notifications")
+	}
+	return config, nil
+}
+
+// Name implements Notifier
+func (t *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+// Notify sends err to every chat it routes to
+func (t *TelegramNotifier) Notify(err *errorid.ErrorWithID) error {
+	return t.notify(err, Delivery{})
+}
+
+// NotifyDelivery implements deliveryNotifier; retries only go to the chats
+// that failed before
+func (t *TelegramNotifier) NotifyDelivery(err *errorid.ErrorWithID, delivery Delivery, done func(error)) {
+	done(t.notify(err, delivery))
+}
+
+// notify sends err to the chats delivery includes. Failed chats are
+// reported as targetErrors keyed by chat ID.
+func (t *TelegramNotifier) notify(err *errorid.ErrorWithID, delivery Delivery) error {
+	chats := t.resolve(err)
+	if len(chats) == 0 {
+		return fmt.Errorf("no Telegram chat configured for %s", err.ID)
+	}
+	text, attachStack := buildTelegramMessage(err)
+
+	failed := targetErrors{}
+	for _, chatID := range chats {
+		if !delivery.includes(chatID) {
+			continue
+		}
+		if sendErr := t.send(chatID, err, text, attachStack); sendErr != nil {
+			failed[chatID] = sendErr
+		}
+	}
+	return failed.err()
+}
+
+// resolve returns the unique chat IDs for err, in route order. Errors whose
+// matching routes have no chats go to the default chats like unmatched errors.
+func (t *TelegramNotifier) resolve(err *errorid.ErrorWithID) []string {
+	var chats []string
+	for _, route := range t.routes.Routes {
+		if !route.Match.Matches(err) {
+			continue
+		}
+		chats = appendUniqueStrings(chats, route.ChatIDs...)
+		if !route.Continue {
+			break
+		}
+	}
+	if len(chats) == 0 {
+		chats = appendUniqueStrings(chats, t.routes.Default...)
+	}
+	return chats
+}
+
+// send delivers the message to one chat, followed by the stack trace
+// document when it did not fit. The document is best effort: once the
+// message is out, a failed upload is only logged so a retry does not post
+// the message twice.
+func (t *TelegramNotifier) send(chatID string, err *errorid.ErrorWithID, text string, attachStack bool) error {
+	body, marshalErr := json.Marshal(telegramMessage{
+		ChatID:                chatID,
+		Text:                  text,
+		ParseMode:             "MarkdownV2",
+		DisableWebPagePreview: true,
+	})
+	if marshalErr != nil {
+		return fmt.Errorf("failed to marshal Telegram message: %w", marshalErr)
+	}
+	if sendErr := t.messages.Post(err.ID, body); sendErr != nil {
+		return sendErr
+	}
+	if attachStack {
+		if docErr := t.sendStackTrace(chatID, err); docErr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send Telegram stack trace for %s to %s: %v\n", err.ID, chatID, docErr)
+		}
+	}
+	return nil
+}
+
+// sendStackTrace uploads the full stack trace as a text document
+func (t *TelegramNotifier) sendStackTrace(chatID string, err *errorid.ErrorWithID) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("chat_id", chatID)
+	writer.WriteField("caption", truncateString(fmt.Sprintf("Stack trace for %s: %s", err.ID, err.Context), telegramMaxCaption))
+	part, createErr := writer.CreateFormFile("document", err.ID+"-stacktrace.txt")
+	if createErr != nil {
+		return fmt.Errorf("failed to create Telegram document: %w", createErr)
+	}
+	part.Write([]byte(err.StackTrace))
+	if closeErr := writer.Close(); closeErr != nil {
+		return fmt.Errorf("failed to create Telegram document: %w", closeErr)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", writer.FormDataContentType())
+	return t.documents.PostWithHeaders(err.ID+" stack trace", body.Bytes(), header)
+}
+
+// buildTelegramMessage renders err as MarkdownV2 within the message limit.
+// Every field is cut after escaping, so the head and footer always fit and
+// only the details and stack trace give way to long errors. It reports
+// whether the stack trace must be sent separately as a document.
+func buildTelegramMessage(err *errorid.ErrorWithID) (string, bool) {
+	severity := errorSeverity(err)
+	meta := getRuntimeMetadata()
+
+	var head strings.Builder
+	fmt.Fprintf(&head, "🚨 *Error %s*\n\n", escapeTelegramLimit(err.ID, telegramMaxMetaText))
+	fmt.Fprintf(&head, "*Context:* %s\n", escapeTelegramLimit(err.Context, telegramMaxErrorText))
+	fmt.Fprintf(&head, "*Error:* %s\n\n", escapeTelegramLimit(errorMessage(err.Original), telegramMaxErrorText))
+	fmt.Fprintf(&head, "*Severity:* %s\n", escapeTelegram(strings.ToUpper(severity.String())))
+	fmt.Fprintf(&head, "*Environment:* %s\n", escapeTelegramLimit(getEnvironment(), telegramMaxMetaText))
+	fmt.Fprintf(&head, "*Host:* %s\n", escapeTelegramLimit(meta.Location(), telegramMaxMetaText))
+
+	details := ""
+	if len(err.Details) > 0 {
+		details = "\n*Details:*\n" + formatTelegramDetails(err.Details)
+	}
+	footer := "\n_" + escapeTelegramLimit(fmt.Sprintf("%s • fingerprint %s", meta.BuildLabel(), errorFingerprint(err)), telegramMaxMetaText) + "_"
+
+	// Details are dropped before the head or footer when space runs out
+	if telegramLength(head.String()+details+footer) > telegramMaxMessage {
+		details = "\n_Details omitted, message too long_\n"
+	}
+	text := head.String() + details
+
+	if err.StackTrace == "" {
+		return text + footer, false
+	}
+	stack := "\n*Stack Trace:*\n" + telegramCodeBlock(err.StackTrace)
+	if telegramLength(text+stack+footer) <= telegramMaxMessage {
+		return text + stack + footer, false
+	}
+	return text + "\n_Stack trace attached as a file_\n" + footer, true
+}
+
+// formatTelegramDetails renders details as a sorted bullet list
+func formatTelegramDetails(details map[string]interface{}) string {
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result strings.Builder
+	for _, key := range keys {
+		value := escapeTelegramLimit(fmt.Sprint(details[key]), telegramMaxDetailValue)
+		fmt.Fprintf(&result, "• *%s:* %s\n", escapeTelegramLimit(key, telegramMaxMetaText), value)
+	}
+	return result.String()
+}
+
+// escapeTelegram escapes every character MarkdownV2 treats as markup
+func escapeTelegram(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(telegramMarkdownSpecial, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeTelegramLimit escapes s and cuts the result to at most limit UTF-16
+// code units, ending with an escaped "..." when cut. An escape is never
+// separated from the character it belongs to.
+func escapeTelegramLimit(s string, limit int) string {
+	escaped := escapeTelegram(s)
+	if telegramLength(escaped) <= limit {
+		return escaped
+	}
+
+	const ellipsis = `\.\.\.`
+	var b strings.Builder
+	length := 0
+	for _, r := range s {
+		piece := escapeTelegram(string(r))
+		n := telegramLength(piece)
+		if length+n > limit-len(ellipsis) {
+			break
+		}
+		b.WriteString(piece)
+		length += n
+	}
+	return b.String() + ellipsis
+}
+
+// telegramCodeBlock wraps s in a pre block; inside it only '`' and '\'
+// need escaping
+func telegramCodeBlock(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "`", "\\`")
+	return "```\n" + strings.TrimRight(s, "\n") + "\n```\n"
+}
+
+// telegramLength counts UTF-16 code units, as Telegram does. Escapes are
+// counted too, so the result never underestimates the parsed length.
+func telegramLength(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+
+	errorid "github.com/isaui/go-support-id-error"
+)
+
+// Headers added to signed webhook requests
+const (
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// defaultWebhookTemplate is used when no WEBHOOK_TEMPLATE_FILE is set
+const defaultWebhookTemplate = `{
+  "error_id": {{json .ID}},
+  "context": {{json .Context}},
+  "error": {{json .Message}},
+  "severity": {{json .Severity}},
+  "fingerprint": {{json .Fingerprint}},
+  "environment": {{json .Environment}},
+  "service": {{json .Service}},
+  "host": {{json .Host}},
+  "timestamp": {{json .Timestamp}},
+  "details": {{json .Details}},
+  "stack_trace": {{json .StackTrace}}
+}`
+
+// WebhookNotifier posts errors to an arbitrary HTTP endpoint. The JSON body
+// comes from a Go template and requests can be signed with HMAC-SHA256.
+type WebhookNotifier struct {
+	sender   *httpSender
+	template *template.Template
+	secret   []byte
+}
+
+// webhookData is the data passed to the webhook template
+type webhookData struct {
+	ID          string
+	Context     string
+	Message     string
+	Severity    string
+	Fingerprint string
+	Environment string
+	Service     string
+	Host        string
+	Timestamp   string
+	Details     map[string]interface{}
+	StackTrace  string
+}
+
+// NewWebhookNotifier configures the generic webhook from WEBHOOK_URL,
+// WEBHOOK_TEMPLATE_FILE and WEBHOOK_SECRET. It returns nil when WEBHOOK_URL
+// is not set.
+func NewWebhookNotifier() (*WebhookNotifier, error) {
+	url := os.Getenv("WEBHOOK_URL")
+	if url == "" {
+		return nil, nil
+	}
+
+	source, err := templateSource("WEBHOOK_TEMPLATE_FILE", defaultWebhookTemplate)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json":     templateJSON,
+		"truncate": truncateString,
+	}).Option("missingkey=zero").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook template: %w", err)
+	}
+
+	w := &WebhookNotifier{
+		sender:   newHTTPSender("Webhook", url, 0),
+		template: tmpl,
+		secret:   []byte(os.Getenv("WEBHOOK_SECRET")),
+	}
+	if len(w.secret) > 0 {
+		w.sender.sign = w.sign
+	}
+	return w, nil
+}
+
+// Name implements Notifier
+func (w *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Notify renders the template for err and posts it
+func (w *WebhookNotifier) Notify(err *errorid.ErrorWithID) error {
+	body, renderErr := w.render(err)
+	if renderErr != nil {
+		return renderErr
+	}
+	return w.sender.Post(err.ID, body)
+}
+
+// render executes the template and checks that the result is valid JSON
+func (w *WebhookNotifier) render(err *errorid.ErrorWithID) ([]byte, error) {
+	meta := getRuntimeMetadata()
+	details, _ := sanitizeDetails(err.Details)
+
+	data := webhookData{
+		ID:          err.ID,
+		Context:     err.Context,
+		Message:     errorMessage(err.Original),
+		Severity:    errorSeverity(err).String(),
+		Fingerprint: errorFingerprint(err),
+		Environment: getEnvironment(),
+		Service:     meta.Service,
+		Host:        meta.Location(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Details:     details,
+		StackTrace:  err.StackTrace,
+	}
+
+	var body bytes.Buffer
+	if execErr := w.template.Execute(&body, data); execErr != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %w", execErr)
+	}
+	if !json.Valid(body.Bytes()) {
+		return nil, fmt.Errorf("webhook template did not produce valid JSON for %s", err.ID)
+	}
+	return body.Bytes(), nil
+}
+
+// sign sets the timestamp and HMAC-SHA256 signature headers. The signature
+// covers "<timestamp>.<body>", so receivers can reject replayed requests by
+// checking the timestamp is recent.
+func (w *WebhookNotifier) sign(req *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+webhookSignature(w.secret, timestamp, body))
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of "<timestamp>.<body>"
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// templateJSON encodes a value as JSON for use inside webhook templates
+func templateJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}